@@ -1,2 +1,3 @@
 go build -o full network/full/iot_full.go
 go build -o light network/light/iot_light.go
+go build -o node network/node/node.go
@@ -6,8 +6,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
-
-	"github.com/altair-lab/xoreum/common/math"
 )
 
 const (
@@ -15,14 +13,6 @@ const (
 	AddressLength = 32 // can be changed later
 )
 
-var (
-	// original
-	Difficulty = math.BigPow(2, 256-1) // mining difficulty: 10
-
-	// this is for test
-	//Difficulty = math.BigPow(2, 260)
-)
-
 // Hash represents the 32 byte Keccak256 hash of arbitrary data.
 type Hash [HashLength]byte
 
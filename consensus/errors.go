@@ -0,0 +1,35 @@
+package consensus
+
+import "errors"
+
+var (
+	// ErrUnknownAncestor is returned when validating a block requires an ancestor
+	// that is unknown.
+	ErrUnknownAncestor = errors.New("unknown ancestor")
+
+	// ErrInvalidNumber is returned if a block's number doesn't equal it's parent's
+	// plus one.
+	ErrInvalidNumber = errors.New("invalid block number")
+
+	// ErrInvalidTimestamp is returned if block's timestamp is older than parent's
+	ErrInvalidTimestamp = errors.New("block's timestamp is older than parent")
+
+	// ErrFutureBlock is returned if block's timestamp is too far ahead of
+	// local time (so that difficulty can't be lowered with future timestamps)
+	ErrFutureBlock = errors.New("block's timestamp is too far in the future")
+
+	// ErrInvalidVersion is returned if block's header version is unknown or
+	// older than parent's
+	ErrInvalidVersion = errors.New("invalid header version")
+
+	// ErrInvalidDifficulty is returned if block's difficulty is not retargeted
+	// difficulty from its parent
+	ErrInvalidDifficulty = errors.New("invalid difficulty")
+
+	// ErrInvalidPoW is returned if block's hash is not lower than difficulty
+	ErrInvalidPoW = errors.New("block's hash is higher than difficulty")
+
+	// ErrInvalidInterlink is returned if block's interlink is not equal to
+	// parent's updated interlink
+	ErrInvalidInterlink = errors.New("wrong interlink")
+)
@@ -1,17 +1,118 @@
 package pow
 
-import ()
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/altair-lab/xoreum/consensus"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/params"
+)
 
 // implement Engine's functions
 
+// VerifyHeader checks whether a header conforms to the consensus rules:
+// parent should be known, number should be parent's number + 1, timestamp
+// should be between parent's and local time + MaxFutureDrift, difficulty
+// should be retargeted from parent, (optionally) seal should be valid and
+// interlink should be updated from parent.
+func (pow *Pow) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	// Ensure that the header's parent is known
+	if header.Number == 0 {
+		return consensus.ErrUnknownAncestor
+	}
+	parent := chain.GetHeader(header.ParentHash, header.Number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Number+1 != header.Number {
+		return consensus.ErrInvalidNumber
+	}
+	if header.Time < parent.Time {
+		return consensus.ErrInvalidTimestamp
+	}
+	if header.Time > uint64(time.Now().Unix())+params.MaxFutureDrift {
+		return consensus.ErrFutureBlock
+	}
+	if header.Version < parent.Version || header.Version > types.HeaderVersion {
+		return consensus.ErrInvalidVersion
+	}
+
+	// Difficulty should be retargeted from parent
+	if header.Difficulty != pow.CalcDifficulty(chain, header.Time, parent) {
+		return consensus.ErrInvalidDifficulty
+	}
 
-// VerifyHeader checks whether a header conforms to the consensus rules of the
-// stock Ethereum ethash engine.
-func (pow *Pow) VerifyHeader() error {
+	// Verify the seal if requested
+	if seal {
+		if err := pow.VerifySeal(chain, header); err != nil {
+			return err
+		}
+	}
 
+	// Interlink should be parent's interlink updated with parent's level
+	if types.NewBlock(parent, nil).GetUpdatedInterlink() != header.InterLink {
+		return consensus.ErrInvalidInterlink
+	}
+	return nil
 }
 
 // VerifySeal implements consensus.Engine, checking whether the given block satisfies
 // the PoW difficulty requirements.
-func (pow *Pow) VerifySeal() error {
+func (pow *Pow) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	// block hash < target (2^256 / difficulty)
+	if header.Hash().ToBigInt().Cmp(header.Target()) != -1 {
+		return consensus.ErrInvalidPoW
+	}
+	return nil
+}
+
+// Seal finds header's nonce with which header's hash is lower than its target
+// (2^256 / difficulty), so that the header passes VerifySeal.
+func Seal(header *types.Header) {
+	for target := header.Target(); header.Hash().ToBigInt().Cmp(target) >= 0; {
+		header.Nonce++
+	}
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. Difficulty is kept
+// in an epoch (RetargetInterval blocks), and retargeted at the first block of
+// the next epoch so that a block is mined in TargetBlockTime on average.
+func (pow *Pow) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) uint64 {
+	next := parent.Number + 1
+	if next%params.RetargetInterval != 0 {
+		return parent.Difficulty
+	}
+
+	// find the first block of the last epoch
+	first := parent
+	for i := uint64(1); i < params.RetargetInterval; i++ {
+		first = chain.GetHeader(first.ParentHash, first.Number-1)
+		if first == nil {
+			return parent.Difficulty
+		}
+	}
+
+	// clamp actual timespan to [expected / factor, expected * factor]
+	expected := (params.RetargetInterval - 1) * params.TargetBlockTime
+	actual := parent.Time - first.Time
+	if actual < expected/params.MaxRetargetFactor {
+		actual = expected / params.MaxRetargetFactor
+	}
+	if actual > expected*params.MaxRetargetFactor {
+		actual = expected * params.MaxRetargetFactor
+	}
+
+	// difficulty = parent_difficulty * expected / actual
+	difficulty := new(big.Int).SetUint64(parent.Difficulty)
+	difficulty.Mul(difficulty, new(big.Int).SetUint64(expected))
+	difficulty.Div(difficulty, new(big.Int).SetUint64(actual))
+	if !difficulty.IsUint64() {
+		return math.MaxUint64
+	}
+	if difficulty.Uint64() < params.MinimumDifficulty {
+		return params.MinimumDifficulty
+	}
+	return difficulty.Uint64()
 }
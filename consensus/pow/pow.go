@@ -1,6 +1,17 @@
 package pow
 
-import ()
+import (
+	"github.com/altair-lab/xoreum/consensus"
+)
 
+// Pow is a proof-of-work consensus engine (block hash < difficulty)
 type Pow struct {
 }
+
+// make sure Pow implements consensus.Engine
+var _ consensus.Engine = (*Pow)(nil)
+
+// New creates a proof-of-work consensus engine
+func New() *Pow {
+	return &Pow{}
+}
@@ -1,8 +1,13 @@
 package core
 
 import (
+	"crypto/ecdsa"
+
+	"github.com/altair-lab/xoreum/common"
 	"github.com/altair-lab/xoreum/consensus"
+	"github.com/altair-lab/xoreum/core/rawdb"
 	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
 )
 
 type BlockValidator struct {
@@ -10,15 +15,111 @@ type BlockValidator struct {
 	engine consensus.Engine // Consensus engine used for validating
 }
 
-func (v *BlockValidator) ValidateBody(block *types.Block) error {
+// NewBlockValidator returns a new block validator which is safe for re-use
+func NewBlockValidator(blockchain *BlockChain, engine consensus.Engine) *BlockValidator {
+	return &BlockValidator{
+		bc:     blockchain,
+		engine: engine,
+	}
+}
 
-	if v.bc.CurrentBlock().Hash() == block.Hash() {
+// ValidateHeader validates the given block's header with consensus engine
+// (difficulty and interlink).
+func (v *BlockValidator) ValidateHeader(block *types.Block) error {
+	return v.engine.VerifyHeader(v.bc, block.Header(), true)
+}
+
+// ValidateBody validates the given block's tx root and txs (fields and signatures)
+func (v *BlockValidator) ValidateBody(block *types.Block) error {
+	if v.bc.HasBlock(block.Hash(), block.Number()) {
 		return ErrKnownBlock
 	}
 
+	if block.Transactions().Hash() != block.Header().TxHash {
+		return ErrWrongTxRoot
+	}
+
+	for _, tx := range block.Transactions() {
+		if err := tx.ValidateTx(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// ValidateState validates the given block's txs and state root on top of current
+// state. txs are checked in order, so a tx can be followed by its next tx in the block.
 func (v *BlockValidator) ValidateState(block *types.Block) error {
+	lookup := newBlockTxLookup(v.bc.db, block)
+	current := make(map[common.Address]common.Hash) // states changed by txs in the block
+	currentState := func(key *ecdsa.PublicKey) common.Hash {
+		if hash, ok := current[crypto.PubkeyToAddress(key)]; ok {
+			return hash
+		}
+		return rawdb.ReadState(v.bc.db, key)
+	}
+
+	for _, tx := range block.Transactions() {
+		if err := validateTxState(tx, lookup, currentState); err != nil {
+			return err
+		}
+		for _, key := range tx.Participants() {
+			current[crypto.PubkeyToAddress(key)] = tx.Hash
+		}
+	}
+
+	// state root should be same with state trie's root after applying txs
+	if v.bc.calcStateRoot(block.Transactions()) != block.Header().Root {
+		return ErrWrongStateRoot
+	}
+	return nil
+}
+
+// validateTxState checks tx with participants' current state:
+// every participant appears once and its prev tx should be its current
+// state, nonces should be increased by 1 and balance sum should not be changed.
+func validateTxState(tx *types.Transaction, lookup types.TxLookup, currentState func(*ecdsa.PublicKey) common.Hash) error {
+	participants := tx.Participants()
+	postStates := tx.PostStates()
+	prevTxHashes := tx.PrevTxHashes()
+	if len(participants) != len(postStates) || len(participants) != len(prevTxHashes) {
+		return types.ErrDiffFieldLength
+	}
+
+	participated := make(map[common.Address]bool)
+	for i, key := range participants {
+		if key == nil || postStates[i] == nil || prevTxHashes[i] == nil {
+			return types.ErrNoFields
+		}
+
+		// A participant should appear only once (its prev state can be spent once)
+		address := crypto.PubkeyToAddress(key)
+		if participated[address] {
+			return types.ErrDuplicateParticipant
+		}
+		participated[address] = true
+
+		// Prev tx should be participant's current state
+		if currentState(key) != *prevTxHashes[i] {
+			return ErrIncorrectPrevState
+		}
+
+		// Load participant's prev state (empty account if there is no prev tx)
+		prevState, err := tx.GetPrevState(lookup, i)
+		if err != nil {
+			return ErrIncorrectPrevState
+		}
+
+		// Check Nonce
+		if postStates[i].Nonce != prevState.Nonce+1 {
+			return ErrIncorrectNonce
+		}
+	}
+
+	// Check Balance Sum
+	if err := tx.CheckBalanceSum(lookup); err != nil {
+		return ErrIncorrectBalance
+	}
 	return nil
 }
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus"
+	"github.com/altair-lab/xoreum/consensus/pow"
+	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/state"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/params"
+)
+
+func TestDuplicateParticipants(t *testing.T) {
+	users := newTestUsers(1)
+	bc := users.newBlockChain()
+
+	// user 0 spends its prev state (balance 100) twice, and mints 100 coins
+	key := &users.keys[0].PublicKey
+	prev := users.alloc[0].Hash
+	tx := types.NewTransaction(
+		[]*ecdsa.PublicKey{key, key},
+		[]*state.Account{state.NewAccount(key, 1, 200), state.NewAccount(key, 1, 0)},
+		[]*common.Hash{&prev, &prev},
+	)
+	tx.Sign(users.keys[0])
+	tx.Signature_R[1], tx.Signature_S[1] = tx.Signature_R[0], tx.Signature_S[0]
+
+	if err := tx.ValidateTx(); err != types.ErrDuplicateParticipant {
+		t.Fatalf("tx with duplicate participants is valid, err %v", err)
+	}
+	if err := validateTxState(tx, rawdb.NewTxLookup(bc.GetDB()), func(key *ecdsa.PublicKey) common.Hash {
+		return rawdb.ReadState(bc.GetDB(), key)
+	}); err != types.ErrDuplicateParticipant {
+		t.Fatalf("tx with duplicate participants is valid on state, err %v", err)
+	}
+
+	pool := NewTxPool(bc)
+	defer pool.Stop()
+	if _, err := pool.Add(tx); err == nil {
+		t.Fatal("tx with duplicate participants is added to txpool")
+	}
+
+	block := mineBlock(bc, common.Address{}, types.Transactions{tx})
+	if err := bc.Insert(block); err != types.ErrDuplicateParticipant {
+		t.Fatalf("block with duplicate participants is inserted, err %v", err)
+	}
+	if bc.CurrentBlock().Number() != 0 {
+		t.Fatal("current block is changed")
+	}
+}
+
+func TestFutureBlock(t *testing.T) {
+	bc := newTestUsers(1).newBlockChain()
+
+	header := mineBlock(bc, common.Address{}, nil).GetHeader()
+	header.Time = uint64(time.Now().Unix()) + params.MaxFutureDrift + 60
+	pow.Seal(header)
+	if err := bc.Insert(types.NewBlock(header, nil)); err != consensus.ErrFutureBlock {
+		t.Fatalf("future block is inserted, err %v", err)
+	}
+
+	header = mineBlock(bc, common.Address{}, nil).GetHeader()
+	header.Time = uint64(time.Now().Unix()) + params.MaxFutureDrift/2
+	pow.Seal(header)
+	if err := bc.Insert(types.NewBlock(header, nil)); err != nil {
+		t.Fatalf("block in allowed drift is not inserted, err %v", err)
+	}
+}
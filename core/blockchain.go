@@ -4,28 +4,59 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"math/big"
+	"sync"
 	"sync/atomic"
 
 	"github.com/altair-lab/xoreum/xordb"
 
 	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus"
+	"github.com/altair-lab/xoreum/consensus/pow"
 	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/state"
 	"github.com/altair-lab/xoreum/core/types"
 	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/log"
 	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/trie"
 )
 
 var (
-	// incorrect block's number (current_block_number + 1 != insert_block's_number)
+	// incorrect block's number (parent_block_number + 1 != insert_block's_number)
 	ErrWrongBlockNumber = errors.New("incorrect block number")
 
-	ErrWrongParentHash = errors.New("block's parent hash does not match with current block")
+	ErrWrongParentHash = errors.New("block's parent hash does not match with any known block")
 
-	ErrTooHighHash = errors.New("block's hash is higher than difficulty")
+	ErrTooHighHash = consensus.ErrInvalidPoW
 
-	ErrWrongInterlink = errors.New("wrong interlink")
+	ErrWrongInterlink = consensus.ErrInvalidInterlink
+
+	ErrWrongStateRoot = errors.New("block's state root does not match with state after applying txs")
+
+	ErrWrongTxRoot = errors.New("block's tx root does not match with block's txs")
+
+	// ErrInvalidReorg is returned when common ancestor of two chains is not found
+	ErrInvalidReorg = errors.New("cannot find common ancestor for reorg")
+
+	// ErrMissingTd is returned when total difficulty of block's parent (or
+	// current block) is not stored
+	ErrMissingTd = errors.New("total difficulty is not found")
+
+	// ErrBadBlock is returned when block is (or descends from) a block whose
+	// txs were invalid on reorg
+	ErrBadBlock = errors.New("block is on a bad chain")
 )
 
+// maxBadBlocks is the number of bad blocks which blockchain remembers
+const maxBadBlocks = 1024
+
+// BlockChainVersion is the version of database schema and hashing rules
+// 0: headers and txs are hashed with go formatting (legacy)
+// 1: headers and txs have encoding version, and new ones are hashed with canonical rlp encoding
+// 2: total difficulty is stored for every canonical block
+const BlockChainVersion = uint64(2)
+
 type BlockChain struct {
 	//ChainID *big.Int // chainId identifies the current chain and is used for replay protection
 
@@ -33,24 +64,45 @@ type BlockChain struct {
 
 	genesisBlock *types.Block
 	currentBlock atomic.Value
+
+	chainmu   sync.Mutex           // blockchain insertion lock
+	badBlocks map[common.Hash]bool // blocks whose txs were invalid on reorg (and their descendants)
+
+	engine    consensus.Engine
+	validator *BlockValidator
+
+	triedb    *trie.Database   // database which state trie nodes are stored in
+	stateTrie *state.StateTrie // merkle trie of current state (root is current block's Header.Root)
+
+	// IoT blockchain which keeps only watched addresses' states (nil: all states).
+	// their states are updated with txs in valid blocks, and state root is not checked.
+	watched map[common.Address]bool
+
+	chainHeadFeed feed // new heads of canonical chain (ChainHeadEvent)
+	chainSideFeed feed // blocks stored in side chains (ChainSideEvent)
+	reorgFeed     feed // switches of canonical chain (ReorgEvent)
 }
 
 func (bc *BlockChain) Genesis() *types.Block { return bc.genesisBlock }
 
+// NewBlockChain makes blockchain with default consensus engine (pow)
 func NewBlockChain(db xordb.Database) *BlockChain {
-	bc := &BlockChain{
-		db:           db,
-		genesisBlock: params.GetGenesisBlock(),
-	}
+	return NewBlockChainWithEngine(db, pow.New())
+}
+
+// NewBlockChainWithEngine makes blockchain which validates headers with engine
+func NewBlockChainWithEngine(db xordb.Database, engine consensus.Engine) *BlockChain {
+	bc := newBlockChain(db, params.GetGenesisBlock(), engine)
 
 	// Set current block
 	last_BN := rawdb.ReadHeaderNumber(db, rawdb.ReadLastHeaderHash(db))
 
 	if last_BN == nil {
-		bc.insert(bc.genesisBlock)
+		bc.insertGenesis()
 	} else {
 		//bc.insert(rawdb.LoadBlockByBN(db, *last_BN))
 		bc.currentBlock.Store(rawdb.LoadBlockByBN(db, *last_BN))
+		bc.loadStateTrie()
 	}
 
 	//bc.accounts = state.NewAccounts()
@@ -59,42 +111,209 @@ func NewBlockChain(db xordb.Database) *BlockChain {
 }
 
 func NewIoTBlockChain(db xordb.Database, genesis *types.Block) *BlockChain {
-	bc := &BlockChain{
-		db:           db,
-		genesisBlock: genesis,
-	}
+	bc := newBlockChain(db, genesis, pow.New())
 
 	// Set current block
 	last_BN := rawdb.ReadHeaderNumber(db, rawdb.ReadLastHeaderHash(db))
 	if last_BN == nil {
-		bc.insert(bc.genesisBlock)
+		bc.insertGenesis()
 		rawdb.WriteGenesisHeaderHash(db, bc.genesisBlock.GetHeader().Hash())
 	} else {
 		bc.currentBlock.Store(rawdb.LoadBlockByBN(db, *last_BN))
 	}
 
+	// state is received from full node, so state trie might be rebuilt
+	bc.loadStateTrie()
+
 	return bc
 }
 
-func NewBlockChainForBitcoin(db xordb.Database) (*BlockChain, *ecdsa.PrivateKey) {
+// NewWatchedIoTBlockChain makes IoT blockchain which keeps only states of
+// watched addresses. the states should be proven and written into db before.
+func NewWatchedIoTBlockChain(db xordb.Database, genesis *types.Block, watched []common.Address) *BlockChain {
+	bc := newBlockChain(db, genesis, pow.New())
+	bc.watched = make(map[common.Address]bool)
+	for _, address := range watched {
+		bc.watched[address] = true
+	}
 
-	gBlock, genesisPrivateKey := params.GetGenesisBlockForBitcoin()
+	// Set current block
+	last_BN := rawdb.ReadHeaderNumber(db, rawdb.ReadLastHeaderHash(db))
+	if last_BN == nil {
+		bc.insertGenesis()
+		rawdb.WriteGenesisHeaderHash(db, bc.genesisBlock.GetHeader().Hash())
+	} else {
+		bc.currentBlock.Store(rawdb.LoadBlockByBN(db, *last_BN))
+	}
+	return bc
+}
+
+// Watched returns watched addresses of IoT blockchain (nil if it keeps all states)
+func (bc *BlockChain) Watched() []common.Address {
+	if bc.watched == nil {
+		return nil
+	}
+	watched := make([]common.Address, 0, len(bc.watched))
+	for address := range bc.watched {
+		watched = append(watched, address)
+	}
+	return watched
+}
+
+// UpdateIoTGenesis replaces genesis of IoT blockchain with current block, and
+// deletes old blocks which light node does not need anymore. current block's
+// interlink blocks and the last RetargetInterval blocks (for difficulty
+// retargeting) are kept. txs of deleted blocks which are still in state are
+// stored alone.
+func (bc *BlockChain) UpdateIoTGenesis() {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	bc.updateIoTGenesis()
+}
+
+func (bc *BlockChain) updateIoTGenesis() {
+	current := bc.CurrentBlock()
+	keep := make(map[uint64]bool)
+	for _, number := range current.GetHeader().InterLink {
+		keep[number] = true
+	}
+
+	// old genesis's interlink blocks and blocks after them might be deleted
+	old := bc.genesisBlock.GetHeader()
+	candidates := append([]uint64{}, old.InterLink[:]...)
+	from := uint64(1)
+	if old.Number > params.RetargetInterval {
+		from = old.Number - params.RetargetInterval + 1
+	}
+	for number := from; number+params.RetargetInterval <= current.Number(); number++ {
+		candidates = append(candidates, number)
+	}
+
+	for _, number := range candidates {
+		if keep[number] {
+			continue
+		}
+		hash := rawdb.ReadHash(bc.db, number)
+		header := rawdb.ReadHeader(bc.db, hash, number)
+		if header == nil {
+			continue
+		}
+		if body := rawdb.ReadBody(bc.db, hash, number); body != nil {
+			// tx is not written if it is found by lookup entry, so delete entries first
+			block := types.NewBlock(header, body.Transactions)
+			rawdb.DeleteTxLookupEntries(bc.db, block)
+			for _, tx := range block.Transactions() {
+				for _, key := range tx.Participants() {
+					if rawdb.ReadState(bc.db, key) == tx.Hash {
+						rawdb.WriteTransaction(bc.db, tx.Hash, tx)
+						break
+					}
+				}
+			}
+			rawdb.DeleteBody(bc.db, hash, number)
+		}
+		rawdb.DeleteBlock(bc.db, hash, number)
+	}
+
+	bc.genesisBlock = current
+	rawdb.WriteGenesisHeaderHash(bc.db, current.Hash())
+}
+
+// ApplyStateDelta makes block (which is synchronized without blocks between,
+// e.g. with interlink delta) the current block and genesis of IoT blockchain.
+// states are the addresses' states changed after current block (empty tx hash
+// deletes the address's state), and state root after applying them should be
+// same with block's. (watched IoT blockchain cannot check state root, so states
+// should be proven before)
+func (bc *BlockChain) ApplyStateDelta(block *types.Block, states map[common.Address]common.Hash) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	if bc.watched == nil {
+		t := bc.stateTrie.Copy()
+		for address, txHash := range states {
+			if txHash == (common.Hash{}) {
+				t.Delete(address)
+			} else {
+				t.Update(address, txHash)
+			}
+		}
+		if t.Hash() != block.GetHeader().Root {
+			return ErrWrongStateRoot
+		}
+		bc.stateTrie = t
+		bc.commitState()
+	}
+	for address, txHash := range states {
+		if txHash == (common.Hash{}) {
+			rawdb.DeleteStateByAddress(bc.db, address)
+		} else {
+			rawdb.WriteState(bc.db, address, txHash)
+		}
+	}
+
+	// total difficulty of IoT blockchain starts from its genesis
+	rawdb.WriteTd(bc.db, block.Hash(), block.Number(), new(big.Int).SetUint64(block.GetHeader().Difficulty))
+	bc.insert(block)
+	bc.updateIoTGenesis()
+	bc.chainHeadFeed.post(ChainHeadEvent{Block: block})
+	return nil
+}
+
+// newBlockChain makes blockchain struct with empty state trie
+func newBlockChain(db xordb.Database, genesis *types.Block, engine consensus.Engine) *BlockChain {
+	migrateDatabase(db)
 
 	bc := &BlockChain{
 		db:           db,
-		genesisBlock: gBlock,
+		genesisBlock: genesis,
+		engine:       engine,
+		triedb:       trie.NewDatabase(rawdb.NewStateTrieDatabase(db)),
+		badBlocks:    make(map[common.Hash]bool),
 	}
+	bc.validator = NewBlockValidator(bc, engine)
+	bc.stateTrie, _ = state.NewStateTrie(common.Hash{}, bc.triedb)
+	return bc
+}
+
+// migrateDatabase upgrades old database to BlockChainVersion
+func migrateDatabase(db xordb.Database) {
+	version := rawdb.ReadDatabaseVersion(db)
+	if version != nil && *version >= BlockChainVersion {
+		return
+	}
+	if rawdb.ReadLastHeaderHash(db) != (common.Hash{}) {
+		headers := 0
+		if version == nil {
+			// legacy headers and txs keep version 0, so their hashes are not changed
+			headers = rawdb.MigrateLegacyHeaders(db)
+		}
+		// blocks stored before version 2 might not have total difficulty
+		tds := rawdb.MigrateTd(db)
+		log.Info("Migrated database", "headers", headers, "tds", tds, "version", BlockChainVersion)
+	}
+	rawdb.WriteDatabaseVersion(db, BlockChainVersion)
+}
+
+func NewBlockChainForBitcoin(db xordb.Database) (*BlockChain, *ecdsa.PrivateKey) {
+
+	gBlock, genesisPrivateKey := params.GetGenesisBlockForBitcoin()
+
+	bc := newBlockChain(db, gBlock, pow.New())
 
 	// insert current block
 	last_BN := rawdb.ReadHeaderNumber(db, rawdb.ReadLastHeaderHash(db))
 	if last_BN == nil {
-		bc.insert(bc.genesisBlock)
+		bc.insertGenesis()
 		bc.applyTransaction(bc.genesisBlock.GetTxs())
+		bc.commitState()
 	} else {
 		//bc.insert(rawdb.LoadBlockByBN(db, *last_BN))
 
 		last_block := rawdb.LoadBlockByBN(db, *last_BN)
 		bc.currentBlock.Store(last_block)
+		bc.loadStateTrie()
 	}
 
 	/*
@@ -117,29 +336,74 @@ func NewBlockChainForBitcoin(db xordb.Database) (*BlockChain, *ecdsa.PrivateKey)
 	return bc, genesisPrivateKey
 }
 
-// check block's validity, if ok, then insert block into chain
+// check block's validity, if ok, then insert block into chain.
+// block which is not on the current head is stored as a side chain block,
+// and chain is reorganized if the side chain becomes heavier.
 func (bc *BlockChain) Insert(block *types.Block) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
 
-	// validate block before insert
-	err := bc.validateBlock(block)
+	// blocks on a bad chain are not validated again
+	if bc.badBlocks[block.Hash()] {
+		return ErrBadBlock
+	}
 
-	if err != nil {
+	// validate block before insert
+	if err := bc.validateBlock(block); err != nil {
 		// didn't pass validation
 		return err
-	} else {
-		// pass all validation
-		// insert that block into blockchain
+	}
+	if bc.badBlocks[block.GetHeader().ParentHash] {
+		bc.markBadBlocks(block)
+		return ErrBadBlock
+	}
+
+	current := bc.CurrentBlock()
+	if block.GetHeader().ParentHash == current.Hash() {
+		// extend current chain, txs should be valid on current state
+		// (watched IoT blockchain does not have whole state to check)
+		if bc.watched == nil {
+			if err := bc.validator.ValidateState(block); err != nil {
+				return err
+			}
+		}
+		if _, err := bc.writeBlockWithTd(block); err != nil {
+			return err
+		}
 		bc.insert(block)
 		bc.applyTransaction(block.GetTxs())
+		bc.commitState()
+		bc.chainHeadFeed.post(ChainHeadEvent{Block: block})
 		return nil
 	}
+
+	// side chain block. reorg if it becomes heaviest chain
+	currentTd := bc.GetTd(current.Hash(), current.Number())
+	if currentTd == nil {
+		return ErrMissingTd
+	}
+	td, err := bc.writeBlockWithTd(block)
+	if err != nil {
+		return err
+	}
+	if td.Cmp(currentTd) > 0 {
+		return bc.reorg(current, block)
+	}
+	bc.chainSideFeed.post(ChainSideEvent{Block: block})
+	return nil
 }
 
 // check block's validity, if ok, then insert block into chain
+// (txs are already applied to state by ApplyTransaction)
 func (bc *BlockChain) InsertForBitcoin(block *types.Block) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
 
 	// validate block before insert
 	err := bc.validateBlock(block)
+	if err == nil && bc.calcStateRoot(block.Transactions()) != block.GetHeader().Root {
+		err = ErrWrongStateRoot
+	}
 
 	if err != nil {
 		// didn't pass validation
@@ -147,48 +411,219 @@ func (bc *BlockChain) InsertForBitcoin(block *types.Block) error {
 	} else {
 		// pass all validation
 		// insert that block into blockchain
+		if _, err := bc.writeBlockWithTd(block); err != nil {
+			return err
+		}
 		bc.insert(block)
+		bc.commitState()
+		bc.chainHeadFeed.post(ChainHeadEvent{Block: block})
 		return nil
 	}
 }
 
-// check that this block is valid to be inserted
+// check that this block is valid to be inserted (to any known block)
 func (bc *BlockChain) validateBlock(block *types.Block) error {
 
 	// 1. check block number
-	if bc.CurrentBlock().GetHeader().Number+1 != block.GetHeader().Number {
+	if block.GetHeader().Number == 0 {
 		return ErrWrongBlockNumber
 	}
 
-	// 2. check parent hash
-	if bc.CurrentBlock().Hash() != block.GetHeader().ParentHash {
+	// 2. check parent hash (parent should be known)
+	if bc.GetHeader(block.GetHeader().ParentHash, block.GetHeader().Number-1) == nil {
 		return ErrWrongParentHash
 	}
 
 	// 3. check that block hash < difficulty
-	if block.GetHeader().Hash().ToBigInt().Cmp(common.Difficulty) != -1 {
-		return ErrTooHighHash
-	}
-
 	// 4. check block's interlink
-	if bc.CurrentBlock().GetUpdatedInterlink() != block.GetHeader().InterLink {
-		return ErrWrongInterlink
+	if err := bc.validator.ValidateHeader(block); err != nil {
+		return err
 	}
 
-	// 5. check trie
+	// 5. check trie (state root is checked with state in ValidateState)
 
 	// 6. check txs
+	if err := bc.validator.ValidateBody(block); err != nil {
+		return err
+	}
 
 	// pass all validation. return no err
 	return nil
 }
 
-// Apply transaction to state
+// reorg takes two blocks, an old chain and a new chain and will reconstruct
+// the blocks and state so that new chain becomes canonical chain.
+// state is rewound with txs' PrevTxHashes, and new chain's txs are applied.
+func (bc *BlockChain) reorg(oldHead, newHead *types.Block) error {
+	var (
+		oldChain []*types.Block // old head -> common ancestor (exclusive)
+		newChain []*types.Block // new head -> common ancestor (exclusive)
+		oldBlock = oldHead
+		newBlock = newHead
+	)
+
+	// reduce the longer chain to the same number as the shorter one
+	for oldBlock != nil && oldBlock.Number() > newHead.Number() {
+		oldChain = append(oldChain, oldBlock)
+		oldBlock = bc.GetBlock(oldBlock.GetHeader().ParentHash, oldBlock.Number()-1)
+	}
+	for newBlock != nil && oldBlock != nil && newBlock.Number() > oldBlock.Number() {
+		newChain = append(newChain, newBlock)
+		newBlock = bc.GetBlock(newBlock.GetHeader().ParentHash, newBlock.Number()-1)
+	}
+	// find common ancestor
+	for {
+		if oldBlock == nil || newBlock == nil {
+			return ErrInvalidReorg
+		}
+		if oldBlock.Hash() == newBlock.Hash() {
+			break
+		}
+		if oldBlock.Number() == 0 {
+			return ErrInvalidReorg
+		}
+		oldChain = append(oldChain, oldBlock)
+		newChain = append(newChain, newBlock)
+		oldBlock = bc.GetBlock(oldBlock.GetHeader().ParentHash, oldBlock.Number()-1)
+		newBlock = bc.GetBlock(newBlock.GetHeader().ParentHash, newBlock.Number()-1)
+	}
+
+	// rewind old chain's state (from old head)
+	for _, block := range oldChain {
+		bc.rewindBlock(block)
+	}
+
+	// apply new chain (from common ancestor)
+	for i := len(newChain) - 1; i >= 0; i-- {
+		if err := bc.validator.ValidateState(newChain[i]); err != nil {
+			// restore old chain, and delete canonical hash mappings of
+			// new chain above old head
+			for j := i + 1; j < len(newChain); j++ {
+				bc.rewindBlock(newChain[j])
+			}
+			for j := len(oldChain) - 1; j >= 0; j-- {
+				bc.applyBlock(oldChain[j])
+			}
+			for number := oldHead.Number() + 1; number < newChain[i].Number(); number++ {
+				rawdb.DeleteHash(bc.db, number)
+			}
+			bc.markBadBlocks(newChain[:i+1]...)
+			return err
+		}
+		bc.applyBlock(newChain[i])
+	}
+
+	// delete canonical hash mappings above new head
+	for number := newHead.Number() + 1; number <= oldHead.Number(); number++ {
+		rawdb.DeleteHash(bc.db, number)
+	}
+	rawdb.WriteLastHeaderHash(bc.db, newHead.Hash())
+	bc.currentBlock.Store(newHead)
+	bc.commitState()
+	bc.reorgFeed.post(ReorgEvent{OldChain: reverseBlocks(oldChain), NewChain: reverseBlocks(newChain)})
+	bc.chainHeadFeed.post(ChainHeadEvent{Block: newHead})
+
+	return nil
+}
+
+// reverseBlocks returns blocks in reverse order (as a new slice)
+func reverseBlocks(blocks []*types.Block) []*types.Block {
+	reversed := make([]*types.Block, len(blocks))
+	for i, block := range blocks {
+		reversed[len(blocks)-1-i] = block
+	}
+	return reversed
+}
+
+// applyBlock makes stored block canonical and applies its txs to state
+func (bc *BlockChain) applyBlock(block *types.Block) {
+	rawdb.WriteHash(bc.db, block.Hash(), block.Number())
+	rawdb.WriteTxLookupEntries(bc.db, block)
+	bc.applyTransaction(block.GetTxs())
+}
+
+// rewindBlock reverts block's txs from state (canonical hash is overwritten later)
+func (bc *BlockChain) rewindBlock(block *types.Block) {
+	rawdb.DeleteTxLookupEntries(bc.db, block)
+	bc.rewindTransaction(block.GetTxs())
+}
+
+// markBadBlocks remembers blocks on a bad chain, so that they (and their
+// descendants) are rejected without validation
+func (bc *BlockChain) markBadBlocks(blocks ...*types.Block) {
+	for _, block := range blocks {
+		if len(bc.badBlocks) >= maxBadBlocks {
+			// forget any one of them
+			for hash := range bc.badBlocks {
+				delete(bc.badBlocks, hash)
+				break
+			}
+		}
+		bc.badBlocks[block.Hash()] = true
+	}
+}
+
+// writeBlockWithTd stores block (without canonical mapping) and its total difficulty.
+// parent's total difficulty should be stored.
+func (bc *BlockChain) writeBlockWithTd(block *types.Block) (*big.Int, error) {
+	ptd := bc.GetTd(block.GetHeader().ParentHash, block.Number()-1)
+	if ptd == nil {
+		return nil, ErrMissingTd
+	}
+	td := new(big.Int).Add(ptd, new(big.Int).SetUint64(block.GetHeader().Difficulty))
+	rawdb.WriteBlock(bc.db, block)
+	rawdb.WriteTd(bc.db, block.Hash(), block.Number(), td)
+	return td, nil
+}
+
+// blockTxLookup resolves txs in the block first, and then in db
+type blockTxLookup struct {
+	db  types.TxLookup
+	txs map[common.Hash]*types.Transaction
+}
+
+func newBlockTxLookup(db xordb.Reader, block *types.Block) *blockTxLookup {
+	txs := make(map[common.Hash]*types.Transaction)
+	for _, tx := range block.Transactions() {
+		txs[tx.Hash] = tx
+	}
+	return &blockTxLookup{db: rawdb.NewTxLookup(db), txs: txs}
+}
+
+func (l *blockTxLookup) GetTransaction(hash common.Hash) *types.Transaction {
+	if tx, ok := l.txs[hash]; ok {
+		return tx
+	}
+	return l.db.GetTransaction(hash)
+}
+
+// Apply transaction to state (only watched addresses' in watched IoT blockchain)
 func (bc *BlockChain) applyTransaction(txs *types.Transactions) {
 	for _, tx := range *txs {
 		for _, key := range tx.Participants() {
+			if bc.watched != nil && !bc.watched[crypto.PubkeyToAddress(key)] {
+				continue
+			}
 			// Apply post state
 			rawdb.WriteState(bc.db, crypto.PubkeyToAddress(key), tx.Hash)
+			bc.stateTrie.Update(crypto.PubkeyToAddress(key), tx.Hash)
+		}
+	}
+}
+
+// Rewind transactions from state (participant's state goes back to prev tx)
+func (bc *BlockChain) rewindTransaction(txs *types.Transactions) {
+	for i := len(*txs) - 1; i >= 0; i-- {
+		tx := (*txs)[i]
+		for j, key := range tx.Participants() {
+			prevHash := *tx.PrevTxHashes()[j]
+			if prevHash == (common.Hash{}) {
+				rawdb.DeleteState(bc.db, key)
+				bc.stateTrie.Delete(crypto.PubkeyToAddress(key))
+			} else {
+				rawdb.WriteState(bc.db, crypto.PubkeyToAddress(key), prevHash)
+				bc.stateTrie.Update(crypto.PubkeyToAddress(key), prevHash)
+			}
 		}
 	}
 }
@@ -198,11 +633,71 @@ func (bc *BlockChain) ApplyTransaction(tx *types.Transaction) {
 	for _, key := range tx.Participants() {
 		// Apply post state
 		rawdb.WriteState(bc.db, crypto.PubkeyToAddress(key), tx.Hash)
+		bc.stateTrie.Update(crypto.PubkeyToAddress(key), tx.Hash)
 		// save tx
 		rawdb.WriteTransaction(bc.db, tx.GetHash(), tx)
 	}
 }
 
+// StateRoot returns the root hash of current state trie
+func (bc *BlockChain) StateRoot() common.Hash {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	return bc.stateTrie.Hash()
+}
+
+// CalcStateRoot returns the root hash of state trie after applying txs to current state
+func (bc *BlockChain) CalcStateRoot(txs types.Transactions) common.Hash {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	return bc.calcStateRoot(txs)
+}
+
+func (bc *BlockChain) calcStateRoot(txs types.Transactions) common.Hash {
+	t := bc.stateTrie.Copy()
+	for _, tx := range txs {
+		for _, key := range tx.Participants() {
+			t.Update(crypto.PubkeyToAddress(key), tx.Hash)
+		}
+	}
+	return t.Hash()
+}
+
+// commitState writes state trie nodes into db
+func (bc *BlockChain) commitState() {
+	if _, err := bc.stateTrie.Commit(); err != nil {
+		log.Crit("Failed to commit state trie", "err", err)
+	}
+}
+
+// loadStateTrie opens state trie of current block. if trie nodes are not in db
+// (e.g. state is received from full node), trie is rebuilt with the state in db
+func (bc *BlockChain) loadStateTrie() {
+	root := bc.CurrentBlock().GetHeader().Root
+	if t, err := state.NewStateTrie(root, bc.triedb); err == nil {
+		bc.stateTrie = t
+		return
+	}
+
+	bc.stateTrie, _ = state.NewStateTrie(common.Hash{}, bc.triedb)
+	rawdb.IterateStates(bc.db, func(address common.Address, txHash common.Hash) {
+		bc.stateTrie.Update(address, txHash)
+	})
+	bc.commitState()
+	if bc.stateTrie.Hash() != root {
+		log.Warn("State root mismatch", "have", bc.stateTrie.Hash(), "want", root)
+	}
+}
+
+// insert genesis block with its total difficulty
+func (bc *BlockChain) insertGenesis() {
+	genesis := bc.genesisBlock
+	rawdb.WriteTd(bc.db, genesis.Hash(), genesis.Number(), new(big.Int).SetUint64(genesis.GetHeader().Difficulty))
+	bc.insert(genesis)
+}
+
 // actually insert block
 func (bc *BlockChain) insert(block *types.Block) {
 	rawdb.StoreBlock(bc.db, block)
@@ -238,3 +733,94 @@ func (bc *BlockChain) PrintBlockChain() {
 func (bc *BlockChain) GetDB() xordb.Database {
 	return bc.db
 }
+
+// Engine retrieves the blockchain's consensus engine.
+func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
+
+// CurrentHeader retrieves the current head header of the canonical chain.
+func (bc *BlockChain) CurrentHeader() *types.Header {
+	return bc.CurrentBlock().Header()
+}
+
+// GetHeader retrieves a block header from the database by hash and number.
+func (bc *BlockChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return rawdb.ReadHeader(bc.db, hash, number)
+}
+
+// GetHeaderByNumber retrieves a block header from the database by number.
+func (bc *BlockChain) GetHeaderByNumber(number uint64) *types.Header {
+	hash := rawdb.ReadHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadHeader(bc.db, hash, number)
+}
+
+// GetHeaderByHash retrieves a block header from the database by its hash.
+func (bc *BlockChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadHeader(bc.db, hash, *number)
+}
+
+// GetTd retrieves a block's total difficulty in the chain from the database by hash and number.
+func (bc *BlockChain) GetTd(hash common.Hash, number uint64) *big.Int {
+	return rawdb.ReadTd(bc.db, hash, number)
+}
+
+// HasBlock checks if a block is fully present in the database or not.
+func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
+	return rawdb.HasBody(bc.db, hash, number)
+}
+
+// GetBlock retrieves a block from the database by hash and number.
+func (bc *BlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	if !rawdb.HasHeader(bc.db, hash, number) || !rawdb.HasBody(bc.db, hash, number) {
+		return nil
+	}
+	return rawdb.LoadBlock(bc.db, hash, number)
+}
+
+// GetStateProof returns the address's state (tx hash) in the state trie of
+// header, and merkle proof of it against header's Root.
+func (bc *BlockChain) GetStateProof(header *types.Header, address common.Address) (common.Hash, *state.StateProof, error) {
+	t, err := state.NewStateTrie(header.Root, bc.triedb)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	proof, err := t.Prove(address)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return t.Get(address), proof, nil
+}
+
+// IterateState calls fn with states in the state trie of header, in the
+// order of hashed address from start (see StateTrie.Iterate)
+func (bc *BlockChain) IterateState(header *types.Header, start common.Hash, fn func(address common.Address, txHash common.Hash) bool) error {
+	t, err := state.NewStateTrie(header.Root, bc.triedb)
+	if err != nil {
+		return err
+	}
+	return t.Iterate(start, fn)
+}
+
+// GetTxProof returns the header of canonical block which includes the tx,
+// and merkle proof of the tx against header's TxHash.
+func (bc *BlockChain) GetTxProof(txHash common.Hash) (*types.Header, *types.TxProof, error) {
+	number := rawdb.ReadTxLookupEntry(bc.db, txHash)
+	if number == nil {
+		return nil, nil, types.ErrTxNotInBlock
+	}
+	block := bc.GetBlock(rawdb.ReadHash(bc.db, *number), *number)
+	if block == nil {
+		return nil, nil, types.ErrTxNotInBlock
+	}
+	proof, err := block.ProveTx(txHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block.Header(), proof, nil
+}
@@ -2,111 +2,137 @@ package core
 
 import (
 	"fmt"
+	"testing"
 
-	"github.com/altair-lab/xoreum/xordb/memorydb"
-
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus/pow"
+	"github.com/altair-lab/xoreum/core/rawdb"
 	"github.com/altair-lab/xoreum/core/types"
-	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
 )
 
-func ExampleFunc() {
+func ExampleBlockChain_Insert() {
 
 	db := memorydb.New()
 	bc := NewBlockChain(db)
 
-	var empty_txs []*types.Transaction
-	empty_txs = []*types.Transaction{}
-
 	// will be inserted successfully
-	b1 := types.NewBlock(&types.Header{}, empty_txs)
-	b1.GetHeader().ParentHash = params.GetGenesisBlock().Hash()
-	b1.GetHeader().Number = 1
-	b1.GetHeader().Time = 165706
+	b1 := mineBlock(bc, common.Address{}, nil)
+	fmt.Println("insert b1:", bc.Insert(b1))
 
 	// will fail to be inserted -> ErrWrongParentHash
-	b2 := types.NewBlock(&types.Header{}, empty_txs)
-	b2.GetHeader().Number = 2
-	b2.GetHeader().Time = 1002
-
-	// will fail to be inserted -> ErrTooHighHash
-	b3 := types.NewBlock(&types.Header{}, empty_txs)
-	b3.GetHeader().ParentHash = b1.Hash()
-	b3.GetHeader().Number = 2
-	b3.GetHeader().Time = 10056
-
-	// will fail to be inserted -> ErrWrongInterlink
-	b4 := types.NewBlock(&types.Header{}, empty_txs)
-	b4.GetHeader().ParentHash = b1.Hash()
-	b4.GetHeader().Number = 2
-	b4.GetHeader().Time = 100562
+	h2 := types.CopyHeader(b1.GetHeader())
+	h2.ParentHash = common.Hash{}
+	h2.Number = 2
+	pow.Seal(h2)
+	b2 := types.NewBlock(h2, nil)
+	fmt.Println("insert b2:", bc.Insert(b2))
+
+	// will fail to be inserted -> ErrInvalidPoW
+	h3 := mineBlock(bc, common.Address{}, nil).GetHeader()
+	for h3.Hash().ToBigInt().Cmp(h3.Target()) < 0 {
+		h3.Nonce++
+	}
+	b3 := types.NewBlock(h3, nil)
+	fmt.Println("insert b3:", bc.Insert(b3))
+
+	// will fail to be inserted -> ErrInvalidInterlink
+	h4 := mineBlock(bc, common.Address{}, nil).GetHeader()
+	h4.InterLink[0]++
+	pow.Seal(h4)
+	b4 := types.NewBlock(h4, nil)
+	fmt.Println("insert b4:", bc.Insert(b4))
 
 	// will be inserted successfully
-	b5 := types.NewBlock(&types.Header{}, empty_txs)
-	b5.GetHeader().ParentHash = b1.Hash()
-	b5.GetHeader().Number = 2
-	b5.GetHeader().Time = 100562
-	b5.GetHeader().InterLink = [types.InterlinkLength]uint64{1, 1, 1, 1, 1, 1, 1, 1, 0, 0}
+	b5 := mineBlock(bc, common.Address{}, nil)
+	fmt.Println("insert b5:", bc.Insert(b5))
 
 	// will be inserted successfully
-	b6 := types.NewBlock(&types.Header{}, empty_txs)
-	b6.GetHeader().ParentHash = b5.Hash()
-	b6.GetHeader().Number = 3
-	b6.GetHeader().Time = 100562
-	b6.GetHeader().InterLink = [types.InterlinkLength]uint64{2, 2, 2, 2, 1, 1, 1, 1, 0, 0}
-
-	// try to insert b1
-	err1 := bc.Insert(b1)
-	if err1 != nil {
-		fmt.Println("fail to insert b1:", err1)
-	} else {
-		fmt.Println("success to insert b1")
-	}
+	b6 := mineBlock(bc, common.Address{}, nil)
+	fmt.Println("insert b6:", bc.Insert(b6))
+	fmt.Println("current block:", bc.CurrentBlock().Number())
 
-	// try to insert b2
-	err2 := bc.Insert(b2)
-	if err2 != nil {
-		fmt.Println("fail to insert b2:", err2)
-	} else {
-		fmt.Println("success to insert b2")
-	}
+	// output:
+	// insert b1: <nil>
+	// insert b2: block's parent hash does not match with any known block
+	// insert b3: block's hash is higher than difficulty
+	// insert b4: wrong interlink
+	// insert b5: <nil>
+	// insert b6: <nil>
+	// current block: 3
+}
 
-	// try to insert b3
-	err3 := bc.Insert(b3)
-	if err3 != nil {
-		fmt.Println("fail to insert b3:", err3)
-	} else {
-		fmt.Println("success to insert b3")
+func TestMissingTd(t *testing.T) {
+	users := newTestUsers(1)
+	bc, fork := users.newBlockChain(), users.newBlockChain()
+	db := bc.GetDB()
+	b1 := insertBlock(bc)
+	f1 := mineBlock(fork, common.Address{1}, nil)
+	if err := fork.Insert(f1); err != nil {
+		t.Fatal(err)
 	}
 
-	// try to insert b4
-	err4 := bc.Insert(b4)
-	if err4 != nil {
-		fmt.Println("fail to insert b4:", err4)
-	} else {
-		fmt.Println("success to insert b4")
+	// blocks on (or beside) a block without total difficulty are rejected
+	rawdb.DeleteTd(db, b1.Hash(), b1.Number())
+	if err := bc.Insert(mineBlock(bc, common.Address{}, nil)); err != ErrMissingTd {
+		t.Fatalf("block on parent without td, err %v", err)
+	}
+	if err := bc.Insert(f1); err != ErrMissingTd {
+		t.Fatalf("side block beside head without td, err %v", err)
 	}
 
-	// try to insert b5
-	err5 := bc.Insert(b5)
-	if err5 != nil {
-		fmt.Println("fail to insert b5:", err5)
-	} else {
-		fmt.Println("success to insert b5")
+	// total difficulty is filled when old database is opened
+	rawdb.DeleteTd(db, f1.Hash(), f1.Number())
+	rawdb.WriteDatabaseVersion(db, 1)
+	bc = NewBlockChain(db)
+	if td := bc.GetTd(b1.Hash(), b1.Number()); td == nil || td.Uint64() != 2*b1.GetHeader().Difficulty {
+		t.Fatalf("wrong td after migration %v", td)
 	}
+	insertBlock(bc)
+}
 
-	// try to insert b6
-	err6 := bc.Insert(b6)
-	if err6 != nil {
-		fmt.Println("fail to insert b6:", err6)
-	} else {
-		fmt.Println("success to insert b6")
+func TestReorgFailure(t *testing.T) {
+	// user 2 has state only in fork, so fork's f3 has an invalid tx in bc
+	bc := newTestUsers(2).newBlockChain()
+	forkUsers := newTestUsers(3)
+	fork := forkUsers.newBlockChain()
+	db := bc.GetDB()
+
+	b1 := insertBlock(bc)
+	root := bc.StateRoot()
+	forkBlock := func(txs ...*types.Transaction) *types.Block {
+		block := mineBlock(fork, common.Address{1}, txs)
+		if err := fork.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+	f1, f2 := forkBlock(), forkBlock()
+	f3 := forkBlock(forkUsers.transfer(2, 0, 10))
+	f4 := forkBlock()
+
+	// f1 and f2 are applied before f3 fails, and they are rolled back
+	for _, block := range []*types.Block{f1, f2, f3} {
+		if _, err := bc.writeBlockWithTd(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bc.reorg(b1, f3); err == nil {
+		t.Fatal("reorg to invalid chain")
+	}
+	if bc.CurrentBlock().Hash() != b1.Hash() || rawdb.ReadHash(db, 1) != b1.Hash() || bc.StateRoot() != root {
+		t.Fatal("old chain is not restored")
+	}
+	if hash := rawdb.ReadHash(db, 2); hash != (common.Hash{}) {
+		t.Fatalf("canonical hash above old head is left: %v", hash)
 	}
 
-	// output:
-	// success to insert b1
-	// fail to insert b2: block's parent hash does not match with current block
-	// fail to insert b3: block's hash is higher than difficulty
-	// fail to insert b4: wrong interlink
-	// success to insert b5
-	// success to insert b6
+	// bad chain is not validated again
+	if err := bc.Insert(f4); err != ErrBadBlock {
+		t.Fatalf("block on bad chain, err %v", err)
+	}
+	if bc.CurrentBlock().Hash() != b1.Hash() {
+		t.Fatal("current block is changed")
+	}
+	insertBlock(bc)
 }
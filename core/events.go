@@ -0,0 +1,131 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/altair-lab/xoreum/core/types"
+)
+
+// ChainHeadEvent is posted when a block becomes the head of canonical chain
+type ChainHeadEvent struct {
+	Block *types.Block
+}
+
+// ChainSideEvent is posted when a block is stored in a side chain
+// (it does not become the head of canonical chain)
+type ChainSideEvent struct {
+	Block *types.Block
+}
+
+// ReorgEvent is posted when canonical chain is switched to a heavier chain,
+// before ChainHeadEvent of the new head. blocks are ordered by number
+// (from the block after common ancestor).
+type ReorgEvent struct {
+	OldChain []*types.Block // blocks dropped from canonical chain
+	NewChain []*types.Block // blocks which became canonical
+}
+
+// NewTxsEvent is posted when txs are added into txpool
+type NewTxsEvent struct {
+	Txs types.Transactions
+}
+
+// Subscription is a subscriber of events, which is cancelled by Unsubscribe
+type Subscription struct {
+	feed    *feed
+	send    func(event interface{}) bool
+	dropped uint64 // number of events which are dropped (subscriber's channel was full)
+}
+
+// Unsubscribe stops delivering events to subscriber's channel
+// (the channel is not closed)
+func (sub *Subscription) Unsubscribe() {
+	sub.feed.mu.Lock()
+	defer sub.feed.mu.Unlock()
+	delete(sub.feed.subs, sub)
+}
+
+// Dropped returns the number of events which are dropped because subscriber
+// did not receive them in time
+func (sub *Subscription) Dropped() uint64 { return atomic.LoadUint64(&sub.dropped) }
+
+// feed delivers events of a type to subscribers' channels. events are sent
+// without blocking, so publisher (e.g. blockchain holding its lock) is never
+// blocked by slow subscribers, and subscribers should buffer their channels.
+// zero value is an empty feed.
+type feed struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// subscribe adds subscriber which sends event to its channel without blocking
+func (f *feed) subscribe(send func(event interface{}) bool) *Subscription {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[*Subscription]struct{})
+	}
+	sub := &Subscription{feed: f, send: send}
+	f.subs[sub] = struct{}{}
+	return sub
+}
+
+// post delivers event to every subscriber
+func (f *feed) post(event interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subs {
+		if !sub.send(event) {
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// SubscribeChainHeadEvent delivers new heads of canonical chain to ch
+func (bc *BlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) *Subscription {
+	return bc.chainHeadFeed.subscribe(func(event interface{}) bool {
+		select {
+		case ch <- event.(ChainHeadEvent):
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// SubscribeChainSideEvent delivers blocks which are stored in side chains to ch
+func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) *Subscription {
+	return bc.chainSideFeed.subscribe(func(event interface{}) bool {
+		select {
+		case ch <- event.(ChainSideEvent):
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// SubscribeReorgEvent delivers switches of canonical chain to ch
+func (bc *BlockChain) SubscribeReorgEvent(ch chan<- ReorgEvent) *Subscription {
+	return bc.reorgFeed.subscribe(func(event interface{}) bool {
+		select {
+		case ch <- event.(ReorgEvent):
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// SubscribeNewTxsEvent delivers txs which are added into txpool to ch
+func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) *Subscription {
+	return pool.newTxsFeed.subscribe(func(event interface{}) bool {
+		select {
+		case ch <- event.(NewTxsEvent):
+			return true
+		default:
+			return false
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/altair-lab/xoreum/core/types"
+)
+
+func TestChainEvents(t *testing.T) {
+	users := newTestUsers(3)
+	bc, fork := users.newBlockChain(), users.newBlockChain()
+	pool := NewTxPool(bc)
+	defer pool.Stop()
+
+	heads := make(chan ChainHeadEvent, 10)
+	sides := make(chan ChainSideEvent, 10)
+	reorgs := make(chan ReorgEvent, 10)
+	txs := make(chan NewTxsEvent, 10)
+	bc.SubscribeChainHeadEvent(heads)
+	bc.SubscribeChainSideEvent(sides)
+	bc.SubscribeReorgEvent(reorgs)
+	pool.SubscribeNewTxsEvent(txs)
+
+	// new txs and head
+	tx := users.copy().transfer(0, 1, 10)
+	if _, err := pool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-txs; len(event.Txs) != 1 || event.Txs[0].Hash != tx.Hash {
+		t.Fatal("wrong txs event")
+	}
+	old := insertBlock(bc, tx)
+	if event := <-heads; event.Block.Hash() != old.Hash() {
+		t.Fatal("wrong head event")
+	}
+
+	// fork's first block has the same total difficulty (side chain),
+	// and second one makes reorg
+	f1, f2 := insertBlock(fork), insertBlock(fork)
+	if err := bc.Insert(f1); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-sides; event.Block.Hash() != f1.Hash() || len(heads) != 0 {
+		t.Fatal("wrong side event")
+	}
+	if err := bc.Insert(f2); err != nil {
+		t.Fatal(err)
+	}
+	reorg := <-reorgs
+	if len(reorg.OldChain) != 1 || reorg.OldChain[0].Hash() != old.Hash() ||
+		len(reorg.NewChain) != 2 || reorg.NewChain[0].Hash() != f1.Hash() || reorg.NewChain[1].Hash() != f2.Hash() {
+		t.Fatalf("wrong reorg event %+v", reorg)
+	}
+	if event := <-heads; event.Block.Hash() != f2.Hash() {
+		t.Fatal("wrong head event after reorg")
+	}
+
+	// events are dropped (not blocked) when subscriber's channel is full,
+	// and not delivered after unsubscribe
+	full := make(chan ChainHeadEvent, 1)
+	sub := bc.SubscribeChainHeadEvent(full)
+	for i := 0; i < 3; i++ {
+		insertBlock(bc)
+	}
+	if len(full) != 1 || sub.Dropped() != 2 {
+		t.Fatalf("%d events in channel, %d dropped", len(full), sub.Dropped())
+	}
+	sub.Unsubscribe()
+	<-full
+	insertBlock(bc)
+	if len(full) != 0 {
+		t.Fatal("event after unsubscribe")
+	}
+}
+
+// waitFor waits until cond is true (txpool handles chain events in its goroutine)
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestTxPoolChainEvents(t *testing.T) {
+	users := newTestUsers(4)
+	bc, fork := users.newBlockChain(), users.newBlockChain()
+	forkUsers := users.copy()
+	pool := NewTxPool(bc)
+	defer pool.Stop()
+
+	// txs included in a block from elsewhere are removed
+	txs := []*types.Transaction{users.transfer(0, 1, 10), users.transfer(2, 3, 10)}
+	for _, tx := range txs {
+		if _, err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insertBlock(bc, txs...)
+	if !waitFor(func() bool { return pool.Len() == 0 }) {
+		t.Fatalf("%d included txs are left", pool.Len())
+	}
+
+	// txs of dropped block are re-injected on reorg
+	for i := 0; i < 2; i++ {
+		block := insertBlock(fork)
+		if err := bc.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !waitFor(func() bool { return pool.Len() == len(txs) }) {
+		t.Fatalf("%d txs are re-injected (expected %d)", pool.Len(), len(txs))
+	}
+
+	// txs whose participants' states are changed by other txs are removed
+	// (users 0 and 1 send another tx in the fork)
+	if err := bc.Insert(insertBlock(fork, forkUsers.transfer(1, 0, 5))); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(func() bool { return pool.Len() == 1 && pool.Get(txs[1].Hash) != nil }) {
+		t.Fatalf("%d txs are left (expected 1)", pool.Len())
+	}
+}
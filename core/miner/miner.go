@@ -5,9 +5,9 @@ import (
 	"time"
 
 	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus/pow"
 	"github.com/altair-lab/xoreum/core"
 	"github.com/altair-lab/xoreum/core/types"
-	"github.com/altair-lab/xoreum/crypto"
 )
 
 type Miner struct {
@@ -17,52 +17,56 @@ type Miner struct {
 func (miner *Miner) Start() {}
 func (miner *Miner) Stop()  {}
 
-func (miner Miner) Mine(pool *core.TxPool, difficulty uint64) *types.Block {
+// Mine makes a new block with pending txs in pool. txs are picked in
+// topological order (a tx after its prev txs), so a participant's chained
+// txs can be mined in the same block. txs stay in pool until a canonical
+// block includes them (block may not be inserted). difficulty is retargeted
+// by the chain's consensus engine.
+func (miner Miner) Mine(pool *core.TxPool) *types.Block {
+	header, txs := miner.Prepare(pool)
+	if header == nil {
+		return nil
+	}
+	pow.Seal(header)
+
+	// Make block
+	block := types.NewBlock(header, txs)
+	block.Hash() //set block hash
+
+	return block
+}
+
+// Prepare makes the header of a new block with pending txs in pool (see Mine)
+// before PoW, so that caller can seal it (pow.Seal) without accessing pool and chain.
+// txs are valid on current state, and at most core.MaxBlockTxs txs are picked.
+func (miner Miner) Prepare(pool *core.TxPool) (*types.Header, types.Transactions) {
 	// [TODO] Originally you should get state in TxPool, not by parameter
 	// Get txs from txpool
-	txs := make(types.Transactions, 0)
-	for pool.Len() > 0 {
-		tx, success := pool.DequeueTx()
-		if !success {
-			// empty queue or some synchronization problem in TxQueue-TxList
-			return nil
-		}
-		txs = append(txs, tx)
-	}
+	txs := pool.Pending()
 
 	// Calculate txsHash
 	txsHash := txs.Hash()
 
 	// Make header
-	// [TODO] get parent hash, stateroot hash
-	parentHash := pool.Chain().CurrentBlock().Hash()
-	number := pool.Chain().CurrentBlock().GetHeader().Number + 1
-	stateRoot := crypto.Keccak256Hash([]byte("stateRoot"))
-	header := types.NewHeader(parentHash, miner.Coinbase, stateRoot, txsHash, difficulty, number, uint64(time.Now().Unix()), uint64(0))
-	header.InterLink = pool.Chain().CurrentBlock().GetUpdatedInterlink() // Set Interlink
-
-	// PoW
-	for true {
-		h := header.Hash()
-		// check difficulty
-		if CheckDifficulty(h, common.Difficulty) {
-			break
-		} else {
-			header.Nonce++
-		}
+	parent := pool.Chain().CurrentBlock()
+	parentHash := parent.Hash()
+	number := parent.GetHeader().Number + 1
+	stateRoot := pool.Chain().CalcStateRoot(txs)
+	now := uint64(time.Now().Unix())
+	if now < parent.GetHeader().Time {
+		now = parent.GetHeader().Time
 	}
+	difficulty := pool.Chain().Engine().CalcDifficulty(pool.Chain(), now, parent.Header())
+	header := types.NewHeader(parentHash, miner.Coinbase, stateRoot, txsHash, difficulty, number, now, uint64(0))
+	header.InterLink = parent.GetUpdatedInterlink() // Set Interlink
 
-	// Make block
-	block := types.NewBlock(header, txs)
-	block.Hash() //set block hash
-
-	return block
+	return header, txs
 }
 
-func CheckDifficulty(hash common.Hash, difficulty *big.Int) bool {
+func CheckDifficulty(hash common.Hash, target *big.Int) bool {
 
-	// if hash < difficulty, return -1
-	r := hash.ToBigInt().Cmp(difficulty)
+	// if hash < target, return -1
+	r := hash.ToBigInt().Cmp(target)
 
 	if r == -1 {
 		return true
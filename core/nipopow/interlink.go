@@ -0,0 +1,107 @@
+package nipopow
+
+import (
+	"errors"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus"
+	"github.com/altair-lab/xoreum/core/types"
+)
+
+var (
+	ErrEmptyChain = errors.New("interlink chain has no block")
+
+	ErrWrongHead = errors.New("chain does not start with the head")
+)
+
+// InterlinkChain returns numbers of blocks from genesis to current block, which
+// are linked with interlink. from current block, it follows the latest superblock
+// of level 1, 2, ... and then superblocks of the top level until genesis.
+func InterlinkChain(chain consensus.ChainReader) []uint64 {
+	return InterlinkChainTo(chain, chain.CurrentHeader())
+}
+
+// InterlinkChainTo returns numbers of blocks from genesis to header (which
+// should be in canonical chain) like InterlinkChain.
+func InterlinkChainTo(chain consensus.ChainReader, header *types.Header) []uint64 {
+	numbers := []uint64{header.Number}
+
+	level := uint64(0)
+	for header.Number != 0 {
+		header = chain.GetHeaderByNumber(header.InterLink[level])
+		numbers = append(numbers, header.Number)
+		if level < types.InterlinkLength-1 {
+			level++
+		}
+	}
+
+	// reverse to ascending order
+	for i, j := 0, len(numbers)-1; i < j; i, j = i+1, j-1 {
+		numbers[i], numbers[j] = numbers[j], numbers[i]
+	}
+	return numbers
+}
+
+// InterlinkChainFrom returns numbers of blocks from the block of number from
+// to current block, which are linked with interlink. from current block, it
+// follows the oldest interlink block which is not before from (or parent if
+// there is no such block).
+func InterlinkChainFrom(chain consensus.ChainReader, from uint64) []uint64 {
+	header := chain.CurrentHeader()
+	numbers := []uint64{header.Number}
+
+	for header.Number > from {
+		next := header.Number - 1
+		for _, number := range header.InterLink {
+			if number >= from && number < next {
+				next = number
+			}
+		}
+		header = chain.GetHeaderByNumber(next)
+		numbers = append(numbers, header.Number)
+	}
+
+	// reverse to ascending order
+	for i, j := 0, len(numbers)-1; i < j; i, j = i+1, j-1 {
+		numbers[i], numbers[j] = numbers[j], numbers[i]
+	}
+	return numbers
+}
+
+// VerifyInterlinkChain checks blocks received from a full node (see InterlinkChain).
+// blocks should start with genesis, each block should be valid, and each block's
+// interlink should be updated from the previous block with its level.
+func VerifyInterlinkChain(blocks []*types.Block, genesisHash common.Hash) error {
+	if len(blocks) == 0 {
+		return ErrEmptyChain
+	}
+	if blocks[0].Number() != 0 || blocks[0].Hash() != genesisHash {
+		return ErrWrongGenesis
+	}
+	return verifyLinks(blocks)
+}
+
+// VerifyInterlinkChainFrom checks blocks received from a full node (see
+// InterlinkChainFrom). blocks should start with the head which light node
+// already has, and the following blocks should be linked like VerifyInterlinkChain.
+func VerifyInterlinkChainFrom(blocks []*types.Block, headHash common.Hash) error {
+	if len(blocks) == 0 {
+		return ErrEmptyChain
+	}
+	if blocks[0].Hash() != headHash {
+		return ErrWrongHead
+	}
+	return verifyLinks(blocks)
+}
+
+func verifyLinks(blocks []*types.Block) error {
+	for i := 1; i < len(blocks); i++ {
+		if err := blocks[i].ValidateBlock(); err != nil {
+			return err
+		}
+		if err := VerifyLink(blocks[i-1].Header(), blocks[i].Header()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
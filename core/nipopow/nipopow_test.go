@@ -0,0 +1,101 @@
+package nipopow_test
+
+import (
+	"testing"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus/pow"
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/nipopow"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+// makeChain makes blockchain with n empty blocks mined by coinbase. blocks
+// are mined every TargetBlockTime from genesis's time, so the same chain is
+// made every time (and difficulty is not changed).
+func makeChain(n int, coinbase common.Address) *core.BlockChain {
+	bc := core.NewBlockChain(memorydb.New())
+	for i := 0; i < n; i++ {
+		parent := bc.CurrentBlock()
+		time := parent.GetHeader().Time + params.TargetBlockTime
+		difficulty := bc.Engine().CalcDifficulty(bc, time, parent.Header())
+		header := types.NewHeader(parent.Hash(), coinbase, bc.CalcStateRoot(nil), types.Transactions{}.Hash(), difficulty, parent.Number()+1, time, 0)
+		header.InterLink = parent.GetUpdatedInterlink()
+		pow.Seal(header)
+		if err := bc.Insert(types.NewBlock(header, nil)); err != nil {
+			panic(err)
+		}
+	}
+	return bc
+}
+
+func TestProof(t *testing.T) {
+	long := nipopow.Prove(makeChain(30, common.Address{1}), 3, 6)
+	short := nipopow.Prove(makeChain(15, common.Address{2}), 3, 6)
+
+	for _, proof := range []*nipopow.Proof{long, short} {
+		if err := proof.Verify(params.MainnetGenesisHash, 6); err != nil {
+			t.Fatalf("failed to verify proof: %v", err)
+		}
+		if len(proof.Suffix) != 6 {
+			t.Fatalf("suffix length mismatch: have %d, want 6", len(proof.Suffix))
+		}
+	}
+	if nipopow.Compare(long, short, 3) <= 0 || nipopow.Compare(short, long, 3) >= 0 {
+		t.Fatal("longer chain's proof should be better")
+	}
+
+	// suffix is not scored (it only settles the tip)
+	noSuffix := &nipopow.Proof{Prefix: long.Prefix}
+	if nipopow.Compare(long, noSuffix, 3) != 0 {
+		t.Fatal("suffix is scored")
+	}
+
+	// suffix should follow the last prefix block
+	forged := &nipopow.Proof{Prefix: long.Prefix[:len(long.Prefix)-1], Suffix: long.Suffix}
+	if err := forged.Verify(params.MainnetGenesisHash, 6); err == nil {
+		t.Fatal("forged proof is verified")
+	}
+}
+
+func TestProofDifficulty(t *testing.T) {
+	// blocks with lower difficulty than required are easier superblocks
+	for _, difficulty := range []uint64{0, params.MinimumDifficulty, params.GenesisDifficulty / 2} {
+		proof := nipopow.Prove(makeChain(15, common.Address{1}), 3, 6)
+		tip := types.CopyHeader(proof.Tip())
+		tip.InterLink = proof.Tip().InterLink
+		tip.Difficulty = difficulty
+		pow.Seal(tip)
+		proof.Suffix[len(proof.Suffix)-1] = tip
+		if err := proof.Verify(params.MainnetGenesisHash, 6); err != nipopow.ErrInvalidDifficulty {
+			t.Fatalf("proof with difficulty %d, err %v", difficulty, err)
+		}
+	}
+}
+
+func TestInterlinkChain(t *testing.T) {
+	bc := makeChain(30, common.Address{1})
+	other := makeChain(30, common.Address{2})
+
+	blocks := []*types.Block{}
+	for _, number := range nipopow.InterlinkChain(bc) {
+		blocks = append(blocks, bc.BlockAt(number))
+	}
+	if blocks[0].Number() != 0 || blocks[len(blocks)-1].Hash() != bc.CurrentBlock().Hash() {
+		t.Fatal("interlink chain should be from genesis to current block")
+	}
+	if err := nipopow.VerifyInterlinkChain(blocks, params.MainnetGenesisHash); err != nil {
+		t.Fatalf("failed to verify interlink chain: %v", err)
+	}
+
+	// current block of other chain is not linked with this chain
+	blocks[len(blocks)-1] = other.CurrentBlock()
+	if err := nipopow.VerifyInterlinkChain(blocks, params.MainnetGenesisHash); err == nil {
+		t.Fatal("forged interlink chain is verified")
+	}
+	if err := nipopow.VerifyInterlinkChain(blocks[1:], params.MainnetGenesisHash); err != nipopow.ErrWrongGenesis {
+		t.Fatalf("interlink chain without genesis, err %v", err)
+	}
+}
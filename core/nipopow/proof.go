@@ -0,0 +1,119 @@
+// Package nipopow implements non-interactive proofs of proof-of-work, which let
+// IoT nodes check that a chain is honest with superblocks only (see Header.InterLink).
+package nipopow
+
+import (
+	"github.com/altair-lab/xoreum/consensus"
+	"github.com/altair-lab/xoreum/core/types"
+)
+
+// Proof is a non-interactive proof of proof-of-work of a chain
+// Prefix: superblocks of the chain except the last k blocks (starts with genesis)
+// Suffix: the last k blocks of the chain
+type Proof struct {
+	Prefix []*types.Header `json:"prefix"`
+	Suffix []*types.Header `json:"suffix"`
+}
+
+// Headers returns proof's chain (prefix + suffix)
+func (p *Proof) Headers() []*types.Header {
+	headers := make([]*types.Header, 0, len(p.Prefix)+len(p.Suffix))
+	headers = append(headers, p.Prefix...)
+	return append(headers, p.Suffix...)
+}
+
+// Tip returns the last header of the proven chain
+func (p *Proof) Tip() *types.Header {
+	if len(p.Suffix) > 0 {
+		return p.Suffix[len(p.Suffix)-1]
+	}
+	if len(p.Prefix) > 0 {
+		return p.Prefix[len(p.Prefix)-1]
+	}
+	return nil
+}
+
+// Level returns header's superblock level (capped with InterlinkLength)
+// genesis is a superblock of every level
+func Level(header *types.Header) uint64 {
+	if header.Number == 0 {
+		return types.InterlinkLength
+	}
+	level := types.NewBlock(header, nil).GetLevel()
+	if level > types.InterlinkLength {
+		level = types.InterlinkLength
+	}
+	return level
+}
+
+// Prove makes a proof of chain's current chain
+// for each level from the top, prefix takes superblocks of the level after
+// the m-th last superblock of the upper level.
+func Prove(chain consensus.ChainReader, m, k uint64) *Proof {
+	head := chain.CurrentHeader()
+
+	// prefix ends with the block before the last k blocks
+	tipNumber := uint64(0)
+	if head.Number > k {
+		tipNumber = head.Number - k
+	}
+	tip := chain.GetHeaderByNumber(tipNumber)
+
+	selected := map[uint64]bool{0: true}
+	start := uint64(0)
+	for level := types.InterlinkLength; ; level-- {
+		superblocks := superblocksAfter(chain, tip, level, start)
+		for _, number := range superblocks {
+			selected[number] = true
+		}
+		if uint64(len(superblocks)) >= m {
+			start = superblocks[uint64(len(superblocks))-m]
+		}
+		if level == 0 {
+			break
+		}
+	}
+
+	proof := new(Proof)
+	for i := uint64(0); i <= tipNumber; i++ {
+		if selected[i] {
+			proof.Prefix = append(proof.Prefix, chain.GetHeaderByNumber(i))
+		}
+	}
+	for i := tipNumber + 1; i <= head.Number; i++ {
+		proof.Suffix = append(proof.Suffix, chain.GetHeaderByNumber(i))
+	}
+	return proof
+}
+
+// superblocksAfter returns numbers of superblocks (level >= level) from start
+// to tip in ascending order. superblocks are followed backward with interlink.
+func superblocksAfter(chain consensus.ChainReader, tip *types.Header, level uint64, start uint64) []uint64 {
+	numbers := []uint64{}
+
+	number := tip.Number
+	if Level(tip) < level {
+		number = prevSuperblock(tip, level)
+	}
+	for number >= start {
+		numbers = append(numbers, number)
+		if number == start || number == 0 {
+			break
+		}
+		number = prevSuperblock(chain.GetHeaderByNumber(number), level)
+	}
+
+	// reverse to ascending order
+	for i, j := 0, len(numbers)-1; i < j; i, j = i+1, j-1 {
+		numbers[i], numbers[j] = numbers[j], numbers[i]
+	}
+	return numbers
+}
+
+// prevSuperblock returns number of the latest superblock (level >= level) before header
+func prevSuperblock(header *types.Header, level uint64) uint64 {
+	if level == 0 {
+		return header.Number - 1
+	}
+	return header.InterLink[level-1]
+}
@@ -0,0 +1,223 @@
+package nipopow
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/params"
+)
+
+var (
+	ErrEmptyProof = errors.New("nipopow proof has no block")
+
+	ErrWrongGenesis = errors.New("chain does not start with genesis")
+
+	ErrShortSuffix = errors.New("nipopow proof's suffix is shorter than k")
+
+	ErrInvalidPoW = errors.New("block's hash in nipopow proof is higher than difficulty")
+
+	// ErrInvalidDifficulty is returned if a block's difficulty is lower than
+	// MinimumDifficulty, or could not be retargeted from the previous block's
+	ErrInvalidDifficulty = errors.New("block's difficulty in nipopow proof is not retargeted properly")
+
+	// ErrInvalidLink is returned if a block in proof is neither parent nor
+	// interlinked superblock of the next block
+	ErrInvalidLink = errors.New("nipopow proof's blocks are not linked")
+
+	// ErrInvalidLevel is returned if an interlinked block's level is lower
+	// than the level which the link claims
+	ErrInvalidLevel = errors.New("interlinked block's level is lower than claimed")
+)
+
+// Verify checks that proof starts with genesis, every block has valid pow,
+// prefix blocks are interlinked with their claimed levels, and suffix has
+// k consecutive blocks. difficulty can't be recalculated without all headers,
+// so it is checked to be in the range which retargeting allows (see verifyDifficulty).
+func (p *Proof) Verify(genesisHash common.Hash, k uint64) error {
+	if len(p.Prefix) == 0 {
+		return ErrEmptyProof
+	}
+	if p.Prefix[0].Number != 0 || p.Prefix[0].Hash() != genesisHash {
+		return ErrWrongGenesis
+	}
+	if uint64(len(p.Suffix)) < k && len(p.Prefix) > 1 {
+		return ErrShortSuffix
+	}
+
+	// prefix is linked with parent hash or interlink
+	for i := 1; i < len(p.Prefix); i++ {
+		if err := VerifyLink(p.Prefix[i-1], p.Prefix[i]); err != nil {
+			return err
+		}
+	}
+
+	// suffix is linked with parent hash
+	prev := p.Prefix[len(p.Prefix)-1]
+	for _, header := range p.Suffix {
+		if err := verifySeal(header); err != nil {
+			return err
+		}
+		if err := verifyDifficulty(prev, header); err != nil {
+			return err
+		}
+		if header.Number != prev.Number+1 || header.ParentHash != prev.Hash() {
+			return ErrInvalidLink
+		}
+		prev = header
+	}
+	return nil
+}
+
+// VerifyLink checks that prev is next's parent, or a superblock which next's
+// interlink points to. next's interlink is checked with prev's updated interlink
+// (see Block.GetUpdatedInterlink), so prev's level should justify the link.
+func VerifyLink(prev, next *types.Header) error {
+	if err := verifySeal(next); err != nil {
+		return err
+	}
+	if err := verifyDifficulty(prev, next); err != nil {
+		return err
+	}
+	if next.Number <= prev.Number {
+		return ErrInvalidLink
+	}
+
+	updated := types.NewBlock(prev, nil).GetUpdatedInterlink()
+	if next.Number == prev.Number+1 {
+		if next.ParentHash != prev.Hash() {
+			return ErrInvalidLink
+		}
+		if next.InterLink != updated {
+			return ErrInvalidLevel
+		}
+		return nil
+	}
+
+	// prev is the latest superblock of level i+1 before next, where i is the
+	// lowest interlink index pointing to prev. blocks between them have lower
+	// levels, so next's interlink from i should be same with prev's updated one,
+	// and lower indices should point to the blocks between them.
+	i := 0
+	for i < len(next.InterLink) && next.InterLink[i] != prev.Number {
+		i++
+	}
+	if i == len(next.InterLink) {
+		return ErrInvalidLink
+	}
+	for j := 0; j < len(next.InterLink); j++ {
+		if j >= i && next.InterLink[j] != updated[j] {
+			return ErrInvalidLevel
+		}
+		if j < i && (next.InterLink[j] <= prev.Number || next.InterLink[j] >= next.Number) {
+			return ErrInvalidLink
+		}
+	}
+	return nil
+}
+
+func verifySeal(header *types.Header) error {
+	if header.Number == 0 {
+		return nil
+	}
+	if header.Hash().ToBigInt().Cmp(header.Target()) != -1 {
+		return ErrInvalidPoW
+	}
+	return nil
+}
+
+// verifyDifficulty checks that next's difficulty could be retargeted from
+// prev's. difficulty is not changed in an epoch, and at each retarget it is
+// changed in the range which clamped timespan allows (see Pow.CalcDifficulty).
+func verifyDifficulty(prev, next *types.Header) error {
+	if next.Difficulty < params.MinimumDifficulty {
+		return ErrInvalidDifficulty
+	}
+	retargets := next.Number/params.RetargetInterval - prev.Number/params.RetargetInterval
+	if retargets == 0 {
+		if next.Difficulty != prev.Difficulty {
+			return ErrInvalidDifficulty
+		}
+		return nil
+	}
+
+	expected := (params.RetargetInterval - 1) * params.TargetBlockTime
+	shortest, longest := expected/params.MaxRetargetFactor, expected*params.MaxRetargetFactor
+	min, max := prev.Difficulty, prev.Difficulty
+	for i := uint64(0); i < retargets && (min > params.MinimumDifficulty || max < math.MaxUint64); i++ {
+		min = retarget(min, expected, longest)
+		max = retarget(max, expected, shortest)
+	}
+	if next.Difficulty < min || next.Difficulty > max {
+		return ErrInvalidDifficulty
+	}
+	return nil
+}
+
+// retarget returns difficulty * expected / actual (like Pow.CalcDifficulty)
+func retarget(difficulty, expected, actual uint64) uint64 {
+	d := new(big.Int).SetUint64(difficulty)
+	d.Mul(d, new(big.Int).SetUint64(expected))
+	d.Div(d, new(big.Int).SetUint64(actual))
+	if !d.IsUint64() {
+		return math.MaxUint64
+	}
+	if d.Uint64() < params.MinimumDifficulty {
+		return params.MinimumDifficulty
+	}
+	return d.Uint64()
+}
+
+// Compare compares two verified proofs by superblock score of their prefixes
+// after their last common block (suffixes only prove that the tip is settled).
+// returns 1 if a is better, -1 if b is better, 0 if same.
+func Compare(a, b *Proof, m uint64) int {
+	// find the last common block (at least genesis is common)
+	known := make(map[common.Hash]bool)
+	for _, header := range a.Headers() {
+		known[header.Hash()] = true
+	}
+	lca := uint64(0)
+	for _, header := range b.Headers() {
+		if known[header.Hash()] {
+			lca = header.Number
+		}
+	}
+
+	return Score(a.Prefix, lca, m).Cmp(Score(b.Prefix, lca, m))
+}
+
+// Score returns the best superblock score of headers after the block of number from.
+// a superblock of level l is expected to take difficulty * 2^l hashes, so
+// score of a level is the sum of its superblocks' work, and the best score is
+// taken over levels which have at least m superblocks (level 0 is always counted)
+func Score(headers []*types.Header, from uint64, m uint64) *big.Int {
+	counts := make([]uint64, types.InterlinkLength+1)
+	works := make([]*big.Int, types.InterlinkLength+1)
+	for level := range works {
+		works[level] = new(big.Int)
+	}
+	for _, header := range headers {
+		if header.Number <= from {
+			continue
+		}
+		difficulty := new(big.Int).SetUint64(header.Difficulty)
+		for level := uint64(0); level <= Level(header); level++ {
+			counts[level]++
+			works[level].Add(works[level], new(big.Int).Lsh(difficulty, uint(level)))
+		}
+	}
+
+	best := new(big.Int)
+	for level, count := range counts {
+		if level > 0 && count < m {
+			continue
+		}
+		if works[level].Cmp(best) > 0 {
+			best = works[level]
+		}
+	}
+	return best
+}
@@ -269,6 +269,13 @@ func StoreBlock(db xordb.Writer, block *types.Block) {
 	WriteTxLookupEntries(db, block)
 }
 
+// WriteBlock serializes a block into the database, header and body separately.
+// (canonical hash mapping and tx lookup entries are not written)
+func WriteBlock(db xordb.Writer, block *types.Block) {
+	WriteHeader(db, block.Header())
+	WriteBody(db, block.Hash(), block.Number(), block.Body())
+}
+
 // DeleteBlock removes all block data associated with a hash.
 func DeleteBlock(db xordb.Writer, hash common.Hash, number uint64) {
 	DeleteHash(db, number)
@@ -23,19 +23,44 @@ func WriteState(db xordb.Writer, address common.Address, txHash common.Hash) {
 
 // ReadState reads a tx hash corresponding to the PublicKey's address
 func ReadState(db xordb.Reader, publicKey *ecdsa.PublicKey) common.Hash {
-	address := crypto.PubkeyToAddress(publicKey)
+	return ReadStateByAddress(db, crypto.PubkeyToAddress(publicKey))
+}
+
+// ReadStateByAddress reads a tx hash corresponding to the address
+// (empty hash if the address has no state)
+func ReadStateByAddress(db xordb.Reader, address common.Address) common.Hash {
 	data, _ := db.Get(stateKey(address))
 	return common.BytesToHash(data)
 }
 
 // DeleteState deletes a tx hash corresponding to the PublicKey's address
 func DeleteState(db xordb.Writer, publicKey *ecdsa.PublicKey) {
-	address := crypto.PubkeyToAddress(publicKey)
+	DeleteStateByAddress(db, crypto.PubkeyToAddress(publicKey))
+}
+
+// DeleteStateByAddress deletes a tx hash corresponding to the address
+func DeleteStateByAddress(db xordb.Writer, address common.Address) {
 	if err := db.Delete(stateKey(address)); err != nil {
-		log.Crit("Failed to delete block body", "err", err)
+		log.Crit("Failed to delete state", "err", err)
 	}
 }
 
+// IterateStates calls fn with every address - txHash mapping in the db
+func IterateStates(db xordb.Iteratee, fn func(address common.Address, txHash common.Hash)) {
+	iter := db.NewIteratorWithPrefix(statePrefix)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		fn(common.BytesToAddress(key[len(statePrefix):]), common.BytesToHash(iter.Value()))
+	}
+}
+
+// NewStateTrieDatabase returns the database which state trie nodes are stored in
+// (all keys are prefixed with stateTriePrefix)
+func NewStateTrieDatabase(db xordb.Database) xordb.Database {
+	return NewTable(db, string(stateTriePrefix))
+}
+
 // ReadStates reads all address - txHash mappings in the db
 func ReadStates(db xordb.Database) {
 	fmt.Println("===========states start=========")
@@ -38,6 +38,13 @@ func WriteTxLookupEntries(db xordb.Writer, block *types.Block) {
 	}
 }
 
+// DeleteTxLookupEntries removes the tx lookup entries of all txs in the block
+func DeleteTxLookupEntries(db xordb.Writer, block *types.Block) {
+	for _, tx := range block.Transactions() {
+		DeleteTxLookupEntry(db, tx.Hash)
+	}
+}
+
 // DeleteTxLookupEntry removes all transaction data associated with a hash.
 func DeleteTxLookupEntry(db xordb.Writer, hash common.Hash) {
 	db.Delete(txLookupKey(hash))
@@ -120,3 +127,19 @@ func WriteTransaction(db xordb.Database, hash common.Hash, tx *types.Transaction
 		WriteRawTxData(db, hash, data)
 	}
 }
+
+// txLookup resolves txs from the database (implements types.TxLookup)
+type txLookup struct {
+	db xordb.Reader
+}
+
+// NewTxLookup returns a types.TxLookup which reads txs from db
+func NewTxLookup(db xordb.Reader) types.TxLookup {
+	return &txLookup{db: db}
+}
+
+// GetTransaction retrieves a transaction by hash (nil if not exist)
+func (l *txLookup) GetTransaction(hash common.Hash) *types.Transaction {
+	tx, _, _, _ := ReadTransaction(l.db, hash)
+	return tx
+}
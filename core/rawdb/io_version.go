@@ -0,0 +1,91 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/log"
+	"github.com/altair-lab/xoreum/rlp"
+	"github.com/altair-lab/xoreum/xordb"
+)
+
+// ReadDatabaseVersion retrieves the version of database (nil if not stored)
+func ReadDatabaseVersion(db xordb.Reader) *uint64 {
+	data, _ := db.Get(databaseVersionKey)
+	if len(data) != 8 {
+		return nil
+	}
+	version := binary.BigEndian.Uint64(data)
+	return &version
+}
+
+// WriteDatabaseVersion stores the version of database
+func WriteDatabaseVersion(db xordb.Writer, version uint64) {
+	if err := db.Put(databaseVersionKey, encodeBlockNumber(version)); err != nil {
+		log.Crit("Failed to store database version", "err", err)
+	}
+}
+
+// MigrateLegacyHeaders re-encodes headers which were stored before
+// Header.Version field was added. migrated headers have version 0,
+// so their hashes (and keys) are not changed.
+func MigrateLegacyHeaders(db xordb.Database) int {
+	// header key = headerPrefix + num (8 bytes) + hash (32 bytes)
+	keyLength := len(headerPrefix) + 8 + 32
+
+	keys, headers := [][]byte{}, []*types.Header{}
+	iter := db.NewIteratorWithPrefix(headerPrefix)
+	for iter.Next() {
+		if len(iter.Key()) != keyLength {
+			continue
+		}
+		header, err := types.DecodeLegacyHeader(iter.Value())
+		if err != nil {
+			// already migrated
+			continue
+		}
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		headers = append(headers, header)
+	}
+	iter.Release()
+
+	for i, header := range headers {
+		data, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			log.Crit("Failed to RLP encode header", "err", err)
+		}
+		if err := db.Put(keys[i], data); err != nil {
+			log.Crit("Failed to store header", "err", err)
+		}
+	}
+	return len(headers)
+}
+
+// MigrateTd writes total difficulty of canonical blocks which were stored
+// before total difficulty was kept. total difficulty is accumulated from
+// the first block (or the last block which has it).
+func MigrateTd(db xordb.Database) int {
+	head := ReadHeaderNumber(db, ReadLastHeaderHash(db))
+	if head == nil {
+		return 0
+	}
+
+	n, td := 0, new(big.Int)
+	for number := uint64(0); number <= *head; number++ {
+		hash := ReadHash(db, number)
+		header := ReadHeader(db, hash, number)
+		if header == nil {
+			// pruned block (e.g. before IoT genesis)
+			continue
+		}
+		if stored := ReadTd(db, hash, number); stored != nil {
+			td = stored
+			continue
+		}
+		td = new(big.Int).Add(td, new(big.Int).SetUint64(header.Difficulty))
+		WriteTd(db, hash, number, td)
+		n++
+	}
+	return n
+}
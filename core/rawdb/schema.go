@@ -9,6 +9,9 @@ import (
 
 // The fields below define the low level database schema prefixing.
 var (
+	// version of database schema and hashing rules
+	databaseVersionKey = []byte("DatabaseVersion")
+
 	// the latest known header's hash.
 	lastHeaderKey    = []byte("LastHeader")
 	genesisHeaderKey = []byte("GenesisHeader")
@@ -29,7 +32,9 @@ var (
 	txLookupPrefix = []byte("l")  // txLookupPrefix + hash -> transaction lookup metadata (= blockNumber)
 	txRawPrefix    = []byte("tx") // txRawPrefix + hash -> raw transaction data
 
-	statePrefix = []byte("s") // statePrefix + address ->
+	statePrefix = []byte("s") // statePrefix + address -> txHash (current state of the address)
+
+	stateTriePrefix = []byte("T") // stateTriePrefix + trie node hash -> state trie node
 
 )
 
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"errors"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/trie"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+var ErrInvalidStateProof = errors.New("state proof does not match with state root")
+
+// StateProof is a merkle proof of an address's state (tx hash) in state trie
+// (whose root is Header.Root). Nodes are rlp encoded trie nodes from root to leaf.
+// it also proves that the address has no state.
+type StateProof struct {
+	Nodes [][]byte `json:"nodes"`
+}
+
+func (p *StateProof) Put(key []byte, value []byte) error {
+	p.Nodes = append(p.Nodes, value)
+	return nil
+}
+
+func (p *StateProof) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// Prove returns a merkle proof of the address's state
+func (t *StateTrie) Prove(address common.Address) (*StateProof, error) {
+	proof := new(StateProof)
+	if err := t.trie.Prove(crypto.Keccak256(address.Bytes()), 0, proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// Verify checks the proof against state root and returns the proven tx hash
+// of the address (empty hash if the address has no state)
+func (p *StateProof) Verify(root common.Hash, address common.Address) (common.Hash, error) {
+	db := memorydb.New()
+	for _, node := range p.Nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+
+	value, _, err := trie.VerifyProof(root, crypto.Keccak256(address.Bytes()), db)
+	if err != nil {
+		return common.Hash{}, ErrInvalidStateProof
+	}
+	if value == nil {
+		return common.Hash{}, nil
+	}
+	if len(value) != common.HashLength {
+		return common.Hash{}, ErrInvalidStateProof
+	}
+	return common.BytesToHash(value), nil
+}
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"errors"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/trie"
+)
+
+var ErrMissingPreimage = errors.New("address of hashed key is not found in state trie")
+
+// StateTrie is a merkle trie of state (address - TxHash mapping),
+// which is same with the state saved in db. its root is Header.Root
+type StateTrie struct {
+	db   *trie.Database
+	trie *trie.SecureTrie
+}
+
+// NewStateTrie opens state trie with root (empty trie if root is empty hash)
+func NewStateTrie(root common.Hash, db *trie.Database) (*StateTrie, error) {
+	tr, err := trie.NewSecure(root, db)
+	if err != nil {
+		return nil, err
+	}
+	return &StateTrie{db: db, trie: tr}, nil
+}
+
+// Get returns the current tx hash of the address
+func (t *StateTrie) Get(address common.Address) common.Hash {
+	return common.BytesToHash(t.trie.Get(address.Bytes()))
+}
+
+// Update sets the current tx hash of the address
+func (t *StateTrie) Update(address common.Address, txHash common.Hash) {
+	t.trie.Update(address.Bytes(), txHash.Bytes())
+}
+
+// Delete removes the address from the state
+func (t *StateTrie) Delete(address common.Address) {
+	t.trie.Delete(address.Bytes())
+}
+
+// Hash returns the root hash of the state trie (without commit)
+func (t *StateTrie) Hash() common.Hash {
+	return t.trie.Hash()
+}
+
+// Commit writes trie nodes to the database and returns the root hash
+func (t *StateTrie) Commit() (common.Hash, error) {
+	root, err := t.trie.Commit(nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if root == (common.Hash{}) {
+		// empty trie, nothing to write
+		return root, nil
+	}
+	if err := t.db.Commit(root, false); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+// Iterate calls fn with states in the order of hashed address (keccak256 of
+// address), from hashed address start (inclusive) until fn returns false
+func (t *StateTrie) Iterate(start common.Hash, fn func(address common.Address, txHash common.Hash) bool) error {
+	it := trie.NewIterator(t.trie.NodeIterator(start.Bytes()))
+	for it.Next() {
+		address := t.trie.GetKey(it.Key)
+		if address == nil {
+			return ErrMissingPreimage
+		}
+		if !fn(common.BytesToAddress(address), common.BytesToHash(it.Value)) {
+			return nil
+		}
+	}
+	return it.Err
+}
+
+// Copy returns a copy of the state trie (updates are not shared)
+func (t *StateTrie) Copy() *StateTrie {
+	return &StateTrie{db: t.db, trie: t.trie.Copy()}
+}
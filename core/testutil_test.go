@@ -0,0 +1,96 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"time"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus/pow"
+	"github.com/altair-lab/xoreum/core/state"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+// testKey returns i-th test user's private key (derived from i)
+func testKey(i int) *ecdsa.PrivateKey {
+	key, _ := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("xoreum core test user %d", i))))
+	return key
+}
+
+// testUsers makes txs between test users. every user has 100 balance in
+// allocation, and each tx is chained to its participants' last txs.
+type testUsers struct {
+	keys  []*ecdsa.PrivateKey
+	alloc types.Transactions
+	last  []*types.Transaction // user's last tx (its post state is user's current state)
+}
+
+func newTestUsers(n int) *testUsers {
+	u := &testUsers{}
+	for i := 0; i < n; i++ {
+		key := testKey(i)
+		tx := types.NewTransaction([]*ecdsa.PublicKey{&key.PublicKey}, []*state.Account{state.NewAccount(&key.PublicKey, 0, 100)}, []*common.Hash{{}})
+		tx.Sign(key)
+		u.keys = append(u.keys, key)
+		u.alloc = append(u.alloc, tx)
+		u.last = append(u.last, tx)
+	}
+	return u
+}
+
+// copy returns users with the same last txs (e.g. to make txs of a fork)
+func (u *testUsers) copy() *testUsers {
+	return &testUsers{keys: u.keys, alloc: u.alloc, last: append([]*types.Transaction{}, u.last...)}
+}
+
+// newBlockChain makes blockchain in memory with users' allocation
+func (u *testUsers) newBlockChain() *BlockChain {
+	bc := NewBlockChain(memorydb.New())
+	for _, tx := range u.alloc {
+		bc.ApplyTransaction(tx)
+	}
+	return bc
+}
+
+// transfer makes tx which moves amount from user i to user j
+func (u *testUsers) transfer(i, j int, amount uint64) *types.Transaction {
+	keys := []*ecdsa.PublicKey{&u.keys[i].PublicKey, &u.keys[j].PublicKey}
+	from, to := u.last[i].GetPostState(keys[0]), u.last[j].GetPostState(keys[1])
+	postStates := []*state.Account{
+		state.NewAccount(keys[0], from.Nonce+1, from.Balance-amount),
+		state.NewAccount(keys[1], to.Nonce+1, to.Balance+amount),
+	}
+	prevI, prevJ := u.last[i].Hash, u.last[j].Hash
+	tx := types.NewTransaction(keys, postStates, []*common.Hash{&prevI, &prevJ})
+	tx.Sign(u.keys[i])
+	tx.Sign(u.keys[j])
+	u.last[i], u.last[j] = tx, tx
+	return tx
+}
+
+// mineBlock makes a block with txs on current block of bc
+func mineBlock(bc *BlockChain, coinbase common.Address, txs types.Transactions) *types.Block {
+	parent := bc.CurrentBlock()
+	now := uint64(time.Now().Unix())
+	if now < parent.GetHeader().Time {
+		now = parent.GetHeader().Time
+	}
+	difficulty := bc.Engine().CalcDifficulty(bc, now, parent.Header())
+	header := types.NewHeader(parent.Hash(), coinbase, bc.CalcStateRoot(txs), txs.Hash(), difficulty, parent.Number()+1, now, 0)
+	header.InterLink = parent.GetUpdatedInterlink()
+	pow.Seal(header)
+	block := types.NewBlock(header, txs)
+	block.Hash()
+	return block
+}
+
+// insertBlock mines and inserts a block with txs
+func insertBlock(bc *BlockChain, txs ...*types.Transaction) *types.Block {
+	block := mineBlock(bc, common.Address{}, txs)
+	if err := bc.Insert(block); err != nil {
+		panic(err)
+	}
+	return block
+}
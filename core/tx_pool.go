@@ -3,10 +3,15 @@
 package core
 
 import (
+	"crypto/ecdsa"
 	"errors"
+	"sort"
+	"sync"
 
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core/rawdb"
 	"github.com/altair-lab/xoreum/core/types"
-	//"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/crypto"
 )
 
 // Reference : tx_pool.go#L43
@@ -22,115 +27,421 @@ var (
 
 	// Incorrect Prev state
 	ErrIncorrectPrevState = errors.New("incorrect prev state")
+
+	// Transaction is already in txpool (pending or future)
+	ErrKnownTx = errors.New("known transaction")
+)
+
+// chainEventBuffer is the number of chain events which txpool buffers
+// (a dropped head event is covered by the next one, since txpool resets
+// from the head which it has reset on)
+const chainEventBuffer = 64
+
+const (
+	// MaxFutureTxs is the maximum number of txs waiting for their prev txs
+	// (the oldest one is evicted when a new one arrives)
+	MaxFutureTxs = 1024
+
+	// MaxAccountFutureTxs is the maximum number of future txs which an
+	// account takes part in (the account's oldest one is evicted)
+	MaxAccountFutureTxs = 16
+
+	// MaxBlockTxs is the maximum number of pending txs which are given
+	// to a new block
+	MaxBlockTxs = 1024
 )
 
 // Reference : tx_pool.go#L205
+// txs are pending if every participant's prev tx is its current state or
+// a pending tx, so a participant's txs can be chained before they are mined.
+// txs whose prev txs are unknown wait in future until the prev txs arrive.
 type TxPool struct {
-	all         *txQueue // Queued transactions for time ordering (FIFO)
+	all         *txQueue // Pending transactions in topological order (prev txs first)
 	chain		*BlockChain // Current chain
+	mu          sync.Mutex // lock for txs (txpool reacts to chain events in its own goroutine)
+
+	pending map[common.Hash]*types.Transaction // pending txs by hash
+	tips    map[common.Address]common.Hash     // participant's last pending tx (its state after pending txs)
+	future  map[common.Hash]*types.Transaction // future txs by hash
+	waiting map[common.Hash][]common.Hash      // unknown prev tx -> future txs waiting for it
+	ages    map[common.Hash]uint64             // future tx -> when it is added (to evict the oldest)
+	nextAge uint64
+
+	accountFutures map[common.Address]int // number of future txs which each account takes part in
+
+	newTxsFeed feed // txs which become pending (NewTxsEvent)
+
+	head    *types.Block // head which txpool is reset on
+	headCh  chan ChainHeadEvent
+	headSub *Subscription
+	quit    chan struct{}
 }
 
 func NewTxPool(chain *BlockChain) *TxPool {
 	pool := &TxPool{
 		all:		newTxQueue(),
 		chain:		chain,
+		pending:	make(map[common.Hash]*types.Transaction),
+		tips:		make(map[common.Address]common.Hash),
+		future:		make(map[common.Hash]*types.Transaction),
+		waiting:	make(map[common.Hash][]common.Hash),
+		ages:		make(map[common.Hash]uint64),
+		accountFutures:	make(map[common.Address]int),
+		head:		chain.CurrentBlock(),
+		headCh:		make(chan ChainHeadEvent, chainEventBuffer),
+		quit:		make(chan struct{}),
 	}
 
-	// [TODO] Subscribe events from blockchain
-	// [TODO] Start the event loop
+	// Subscribe new heads from blockchain (reorg is followed by its new head),
+	// and start the event loop
+	pool.headSub = chain.SubscribeChainHeadEvent(pool.headCh)
+	go pool.loop()
 
 	return pool
 }
 
+// loop updates txs in txpool with new heads of blockchain
+func (pool *TxPool) loop() {
+	defer pool.headSub.Unsubscribe()
+	for {
+		select {
+		case <-pool.headCh:
+			pool.reset()
+		case <-pool.quit:
+			return
+		}
+	}
+}
+
+// Stop stops following events of blockchain
+func (pool *TxPool) Stop() {
+	close(pool.quit)
+}
+
+// reset rebuilds txpool on current state. txs included in canonical chain
+// are removed, and txs which are not valid any more (participant's state is
+// changed by other tx) are dropped. txs of blocks dropped from the head which
+// txpool was reset on (by reorg) are re-injected before txs in txpool, since
+// txs in txpool can depend on them. chain lock is held, so that txpool does
+// not see a block which is being inserted.
+func (pool *TxPool) reset() {
+	pool.chain.chainmu.Lock()
+	defer pool.chain.chainmu.Unlock()
+	pool.mu.Lock()
+
+	head := pool.chain.CurrentBlock()
+	dropped := pool.droppedBlocks(pool.head, head)
+	pool.head = head
+
+	txs := types.Transactions{}
+	for _, block := range dropped {
+		txs = append(txs, block.Transactions()...)
+	}
+	txs = append(txs, pool.all.all...)
+	future := make(types.Transactions, 0, len(pool.future))
+	for _, tx := range pool.future {
+		future = append(future, tx)
+	}
+	sort.Slice(future, func(i, j int) bool { return pool.ages[future[i].Hash] < pool.ages[future[j].Hash] })
+	txs = append(txs, future...)
+	wasPending := pool.pending
+
+	pool.all = newTxQueue()
+	pool.pending = make(map[common.Hash]*types.Transaction)
+	pool.tips = make(map[common.Address]common.Hash)
+	pool.future = make(map[common.Hash]*types.Transaction)
+	pool.waiting = make(map[common.Hash][]common.Hash)
+	pool.ages = make(map[common.Hash]uint64)
+	pool.accountFutures = make(map[common.Address]int)
+
+	db := pool.chain.GetDB()
+	promoted := types.Transactions{}
+	for _, tx := range txs {
+		if rawdb.ReadTxLookupEntry(db, tx.Hash) != nil {
+			continue
+		}
+		added, _ := pool.add(tx)
+		for _, tx := range added {
+			if wasPending[tx.Hash] == nil {
+				promoted = append(promoted, tx)
+			}
+		}
+	}
+	pool.mu.Unlock()
+
+	if len(promoted) > 0 {
+		pool.newTxsFeed.post(NewTxsEvent{Txs: promoted})
+	}
+}
+
+// droppedBlocks returns blocks from the common ancestor of oldHead and newHead
+// (exclusive) to oldHead, which are not in canonical chain of newHead
+func (pool *TxPool) droppedBlocks(oldHead, newHead *types.Block) []*types.Block {
+	dropped := []*types.Block{}
+	for oldHead != nil && newHead != nil && oldHead.Hash() != newHead.Hash() {
+		if oldHead.Number() >= newHead.Number() {
+			dropped = append(dropped, oldHead)
+			oldHead = pool.chain.GetBlock(oldHead.GetHeader().ParentHash, oldHead.Number()-1)
+		} else {
+			newHead = pool.chain.GetBlock(newHead.GetHeader().ParentHash, newHead.Number()-1)
+		}
+	}
+	return reverseBlocks(dropped)
+}
+
+// Len returns the number of pending txs
 func (pool *TxPool) Len() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
 	return pool.all.Len()
 }
 
+// Stats returns the number of pending txs and future txs
+func (pool *TxPool) Stats() (int, int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.all.Len(), len(pool.future)
+}
+
 func (pool *TxPool) Chain() *BlockChain {
 	return pool.chain
 }
 
+// Get returns pending or future transaction of the hash (nil if it is not in txpool)
+func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if tx := pool.pending[hash]; tx != nil {
+		return tx
+	}
+	return pool.future[hash]
+}
+
 // Add single transaction to txpool
 // Reference : tx_pool.go#L654
 
 func (pool *TxPool) Add(tx *types.Transaction) (bool, error){
+	if _, err := pool.AddRemote(tx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddRemote adds tx (e.g. received from peer) to txpool like Add, and returns
+// txs which become pending (tx and promoted future txs in topological order),
+// so that caller relays only them. it returns nothing if tx is queued in future.
+func (pool *TxPool) AddRemote(tx *types.Transaction) (types.Transactions, error) {
 	// If the transaction fails basic validation, discard it
 	if err := pool.validateTx(tx); err != nil {
 		// [TODO] Print error
-		return false, err
+		return nil, err
 	}
-	// We don't deal with "full" of transaction pool
+	// We don't deal with "full" of transaction pool (except future txs)
 
 	// [TODO] If the transaction is replacing an already pending one, do directly
 
-	// New transaction isn't replacing a pending one, push into queue
-	replace, err := pool.enqueueTx(tx)
+	// New transaction isn't replacing a pending one, push into pending or future
+	// (under chain lock, so that it is validated against a fully inserted block)
+	pool.chain.chainmu.Lock()
+	pool.mu.Lock()
+	added, err := pool.add(tx)
+	pool.mu.Unlock()
+	pool.chain.chainmu.Unlock()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-
-	return replace, nil
+	if len(added) > 0 {
+		pool.newTxsFeed.post(NewTxsEvent{Txs: added})
+	}
+	return added, nil
 }
 
 
-// validateTx checks whether a transaction is valid according to the consensus
-// rules and adheres to some heuristic limits of the local node (price and size).
+// validateTx checks whether a transaction is well-formed and signed properly
+// (before it is queued even in future). its state is checked when it becomes
+// pending.
 func (pool *TxPool) validateTx(tx *types.Transaction) error {
-	/*
-	for i, key := range tx.Participants() {
-                // [FIXME]
-		//prevState := loadTransaction(tx.PrevTxhashes()[i]).GetPostState(key)
-		tx.PrintTx()
-		prevHash := *tx.PrevTxHashes()[i]
-		if prevHash != (common.Hash{0}) {
-			prevState := pool.chain.GetAllTxs()[prevHash].GetPostState(key)
-
-               		// Check incorrect prev state
-                	if pool.chain.GetAccounts().GetBalance(key) != prevState.Balance {
-                		return ErrIncorrectPrevState
-               		}
-                	if pool.chain.GetAccounts().GetNonce(key) != prevState.Nonce {
-                		return ErrIncorrectPrevState
-               		}
-
-                	// Check Nonce
-                	if tx.GetPostState(key).Nonce != prevState.Nonce + 1 {
-                		return ErrIncorrectNonce
-               		}
-		}
-	}
-
-        // Check Balance Sum
-	postBalanceSum := tx.GetPostBalanceSum()
-	prevBalanceSum := tx.GetPrevBalanceSum()
-        if postBalanceSum != prevBalanceSum {
-                return ErrIncorrectBalance
-        }
-
-	// Make sure the transaction is signed properly
-	validity := tx.VerifySignature() 
-	if validity != nil {
-		return ErrInvalidSender
-	}
-	
-	// nothing
-	*/
-	return nil 
-}
-
-// enqueue a single trasaction to pool.queue, pool.all
-func (pool *TxPool) enqueueTx(tx *types.Transaction) (bool, error) {
+	if err := tx.ValidateTx(); err != nil {
+		// Make sure the transaction is signed properly
+		if err == types.ErrInvalidSig || err == types.ErrNoFields {
+			return ErrInvalidSender
+		}
+		return err
+	}
+
+	return nil
+}
+
+// add puts tx into pending if every prev tx is participant's current state
+// (in db or pending), or into future if some prev tx is unknown. future txs
+// waiting for tx are promoted after it. it returns txs which become pending
+// (tx and promoted future txs in topological order). lock should be held.
+func (pool *TxPool) add(tx *types.Transaction) (types.Transactions, error) {
+	if pool.pending[tx.Hash] != nil || pool.future[tx.Hash] != nil {
+		return nil, ErrKnownTx
+	}
+
+	// pending txs are resolved before txs in db (like txs in a block)
+	db := pool.chain.GetDB()
+	lookup := &blockTxLookup{db: rawdb.NewTxLookup(db), txs: pool.pending}
+	for _, prev := range tx.PrevTxHashes() {
+		if *prev != (common.Hash{}) && lookup.GetTransaction(*prev) == nil {
+			pool.addFuture(tx, *prev)
+			return nil, nil
+		}
+	}
+
+	// Every participant's prev tx should be its last pending tx, or its
+	// current state in db if it has no pending tx
+	currentState := func(key *ecdsa.PublicKey) common.Hash {
+		if hash, ok := pool.tips[crypto.PubkeyToAddress(key)]; ok {
+			return hash
+		}
+		return rawdb.ReadState(db, key)
+	}
+	if err := validateTxState(tx, lookup, currentState); err != nil {
+		return nil, err
+	}
+	pool.enqueueTx(tx)
+
+	// promote future txs which wait for tx
+	added := types.Transactions{tx}
+	waiting := pool.waiting[tx.Hash]
+	delete(pool.waiting, tx.Hash)
+	for _, hash := range waiting {
+		next := pool.future[hash]
+		if next == nil {
+			continue
+		}
+		pool.removeFuture(next)
+		promoted, _ := pool.add(next)
+		added = append(added, promoted...)
+	}
+	return added, nil
+}
+
+// addFuture puts tx into future until prev arrives. the oldest future tx is
+// evicted if future is full, or if tx's participant takes part in too many
+// future txs (so that an account cannot fill future). lock should be held.
+func (pool *TxPool) addFuture(tx *types.Transaction, prev common.Hash) {
+	for _, key := range tx.Participants() {
+		address := crypto.PubkeyToAddress(key)
+		if pool.accountFutures[address] >= MaxAccountFutureTxs {
+			pool.removeFuture(pool.oldestFuture(&address))
+		}
+	}
+	if len(pool.future) >= MaxFutureTxs {
+		pool.removeFuture(pool.oldestFuture(nil))
+	}
+
+	pool.future[tx.Hash] = tx
+	pool.waiting[prev] = append(pool.waiting[prev], tx.Hash)
+	pool.ages[tx.Hash] = pool.nextAge
+	pool.nextAge++
+	for _, key := range tx.Participants() {
+		pool.accountFutures[crypto.PubkeyToAddress(key)]++
+	}
+}
+
+// oldestFuture returns the oldest future tx which address takes part in
+// (any future tx if address is nil)
+func (pool *TxPool) oldestFuture(address *common.Address) *types.Transaction {
+	var oldest *types.Transaction
+	for _, tx := range pool.future {
+		if oldest != nil && pool.ages[tx.Hash] > pool.ages[oldest.Hash] {
+			continue
+		}
+		if address != nil && !hasParticipant(tx, *address) {
+			continue
+		}
+		oldest = tx
+	}
+	return oldest
+}
+
+func hasParticipant(tx *types.Transaction, address common.Address) bool {
+	for _, key := range tx.Participants() {
+		if crypto.PubkeyToAddress(key) == address {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFuture removes tx from future (and from txs waiting for its prev tx)
+func (pool *TxPool) removeFuture(tx *types.Transaction) {
+	delete(pool.future, tx.Hash)
+	delete(pool.ages, tx.Hash)
+	for _, key := range tx.Participants() {
+		address := crypto.PubkeyToAddress(key)
+		if pool.accountFutures[address]--; pool.accountFutures[address] <= 0 {
+			delete(pool.accountFutures, address)
+		}
+	}
+	for _, prev := range tx.PrevTxHashes() {
+		waiting := pool.waiting[*prev]
+		for i, hash := range waiting {
+			if hash == tx.Hash {
+				waiting = append(waiting[:i:i], waiting[i+1:]...)
+				break
+			}
+		}
+		if len(waiting) == 0 {
+			delete(pool.waiting, *prev)
+		} else {
+			pool.waiting[*prev] = waiting
+		}
+	}
+}
+
+// enqueue a single trasaction to pool.all, and index it
+func (pool *TxPool) enqueueTx(tx *types.Transaction) {
 	pool.all.Enqueue(tx)
-	return true, nil
+	pool.pending[tx.Hash] = tx
+	for _, key := range tx.Participants() {
+		pool.tips[crypto.PubkeyToAddress(key)] = tx.Hash
+	}
 }
 
-func (pool *TxPool) DequeueTx() (*types.Transaction, bool){
-	tx := pool.all.Dequeue()
-	if tx == nil {
-		// empty queue
-		return nil, false
+// Pending returns at most MaxBlockTxs pending txs in topological order (prev
+// txs first) without removing them. txs are removed by reset when a canonical
+// block includes them, so txs are validated again on current state (like txs
+// in a block, see ValidateState) and txs which are included or not valid any
+// more are skipped.
+func (pool *TxPool) Pending() types.Transactions {
+	pool.chain.chainmu.Lock()
+	defer pool.chain.chainmu.Unlock()
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	db := pool.chain.GetDB()
+	lookup := &blockTxLookup{db: rawdb.NewTxLookup(db), txs: make(map[common.Hash]*types.Transaction)}
+	current := make(map[common.Address]common.Hash) // states changed by picked txs
+	currentState := func(key *ecdsa.PublicKey) common.Hash {
+		if hash, ok := current[crypto.PubkeyToAddress(key)]; ok {
+			return hash
+		}
+		return rawdb.ReadState(db, key)
+	}
+
+	txs := types.Transactions{}
+	for _, tx := range pool.all.all {
+		if len(txs) >= MaxBlockTxs {
+			break
+		}
+		if rawdb.ReadTxLookupEntry(db, tx.Hash) != nil {
+			continue
+		}
+		if err := validateTxState(tx, lookup, currentState); err != nil {
+			continue
+		}
+		txs = append(txs, tx)
+		lookup.txs[tx.Hash] = tx
+		for _, key := range tx.Participants() {
+			current[crypto.PubkeyToAddress(key)] = tx.Hash
+		}
 	}
-	return tx, true 
+	return txs
 }
 
 type txQueue struct {
@@ -147,14 +458,13 @@ func (t *txQueue) Enqueue(tx *types.Transaction) {
 	t.all = append(t.all, tx)
 }
 
-func (t *txQueue) Dequeue() *types.Transaction {
-	if t.Len() == 0 {
-		// empty
-		return nil
+func (t *txQueue) Get(hash common.Hash) *types.Transaction {
+	for _, tx := range t.all {
+		if tx.Hash == hash {
+			return tx
+		}
 	}
-	x := t.all[0]
-	t.all = t.all[1:]
-	return x
+	return nil
 }
 
 func (t *txQueue) Len() int {
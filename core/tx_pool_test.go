@@ -1,144 +1,180 @@
 package core
 
 import (
+	"crypto/ecdsa"
 	"fmt"
+	"testing"
 
 	"github.com/altair-lab/xoreum/common"
-	"github.com/altair-lab/xoreum/core"
-	"github.com/altair-lab/xoreum/core/miner"
 	"github.com/altair-lab/xoreum/core/state"
 	"github.com/altair-lab/xoreum/core/types"
 	"github.com/altair-lab/xoreum/crypto"
-	//"github.com/davecgh/go-spew/spew"
 )
 
-func ExampleTxpool() {
-
-	// Make accounts
-	fmt.Println("========== Create Accounts ==========")
-	privatekey0, _ := crypto.GenerateKey()
-	publickey0 := privatekey0.PublicKey
-	address0 := crypto.Keccak256Address(common.ToBytes(publickey0))
-	acc0 := state.NewAccount(address0, uint64(0), uint64(7000)) // acc0 [Address:0, Nonce:0, Balance:7000]
-
-	state := state.NewState()
-	state.Add(acc0)
-	state.Print()
-
-	/*
-		privatekey1, _ := crypto.GenerateKey()
-		publickey1 := privatekey1.PublicKey
-		address1 := crypto.Keccak256Address(common.ToBytes(publickey1))
-		acc1 := state.NewAccount(address1, uint64(0), uint64(2000)) // acc1 [Address:1, Nonce:0, Balance:2000]
-
-		privatekey2, _ := crypto.GenerateKey()
-		publickey2 := privatekey2.PublicKey
-		address2 := crypto.Keccak256Address(common.ToBytes(publickey2))
-		acc2 := state.NewAccount(address2, uint64(0), uint64(100))  // acc2 [Address:2, Nonce:0, Balance:100]
-
-		privatekey3, _ := crypto.GenerateKey()
-		publickey3 := privatekey3.PublicKey
-		address3 := crypto.Keccak256Address(common.ToBytes(publickey3))
-		acc3 := state.NewAccount(address3, uint64(0), uint64(100))  // acc3 [Address:3, Nonce:0, Balance:100]
-
-		// [TODO] Set state
-		state := state.NewState()
-		state.Add(acc0)
-		state.Add(acc1)
-		state.Add(acc2)
-		state.Add(acc3)
-		state.Print()
-
-		fmt.Printf("\n")
-
-		// Create transaction
-		fmt.Println("========== Create Transactions ==========")
-		tx0 := types.NewTransaction(0, publickey0, publickey1, uint64(2000)) // send [2000] from [account0] to [account1]
-		tx1 := types.NewTransaction(0, publickey1, publickey0, uint64(500)) // send [500] from [account1] to [account0]
-		tx_overwrite_invalid := types.NewTransaction(0, publickey0, publickey1, uint64(100)) // send [100] from [account0] to [account1]
-		tx2 := types.NewTransaction(1, publickey0, publickey1, uint64(300)) // send [100] from [account0] to [account1]
-		tx_insufficient_invalid := types.NewTransaction(0, publickey3, publickey2, uint64(200)) // send [200] from [account3] to [account2]
-		// tx_nonce_invalid := types.NewTransaction(0, publickey0, publickey1, uint64(5000)) // send [5000] from [account0] to [account1]
-		tx_sender_invalid := types.NewTransaction(0, publickey0, publickey1, uint64(5000)) // send [5000] from [account0] to [account1]
-
-		// Sign to transaction
-		tx0_signed, _ := types.SignTx(tx0, privatekey0) // sign by sender
-		tx1_signed, _ := types.SignTx(tx1, privatekey1) // sign by sender
-		tx_overwrite_signed, _ := types.SignTx(tx_overwrite_invalid, privatekey0) // sign by sender
-		tx2_signed, _ := types.SignTx(tx2, privatekey0) // sign by sender
-		tx_insufficient_signed, _ := types.SignTx(tx_insufficient_invalid, privatekey3) // sign by sender
-		tx_sender_invalid_signed, _ := types.SignTx(tx_sender_invalid, privatekey1) // sign by wrong sender
-
-		tx0_signed, _ = types.SignTx(tx0_signed, privatekey1) // sign by receiver
-		tx1_signed, _ = types.SignTx(tx1_signed, privatekey0) // sign by receiver
-		tx_overwrite_signed, _ = types.SignTx(tx_overwrite_signed, privatekey1) // sign by receiver
-		tx2_signed, _ = types.SignTx(tx2_signed, privatekey1) // sign by receiver
-		tx_insufficient_signed, _ = types.SignTx(tx_insufficient_signed, privatekey2) // sign by receiver
-		tx_sender_invalid_signed, _ = types.SignTx(tx_sender_invalid_signed, privatekey1) // sign by receiver
-	*/
-
-	fmt.Println("========== Create Txs ==========")
-	// Make Test Signed Tx
-	tx0_signed := types.MakeTestSignedTx(2)
-	tx1_signed := types.MakeTestSignedTx(3)
-	tx_sender_invalid_signed := types.MakeTestTx(2)
-
-	// Create Chain, txpool
-	bc := core.NewBlockChain()
-	txpool := core.NewTxPool(state, bc)
-
-	// Add txs to txpool
-	success, err := txpool.Add(tx0_signed)
-	if !success {
-		fmt.Println(err)
-	}
-
-	success, err = txpool.Add(tx1_signed)
-	if !success {
-		fmt.Println(err)
-	}
-	/*
-		success, err = txpool.Add(tx_overwrite_signed)
-		if !success {
-			fmt.Println(err)
+func TestTxPoolDependentTxs(t *testing.T) {
+	// every tx is chained to the previous one (users 0 and 1 send coins back and forth)
+	users := newTestUsers(2)
+	bc := users.newBlockChain()
+	txs := types.Transactions{}
+	for i := 0; i < 4; i++ {
+		txs = append(txs, users.transfer(i%2, 1-i%2, 10))
+	}
+
+	// txs with unknown prev txs wait in future until prev txs arrive
+	pool := NewTxPool(bc)
+	defer pool.Stop()
+	newTxs := make(chan NewTxsEvent, 10)
+	pool.SubscribeNewTxsEvent(newTxs)
+	for i := len(txs) - 1; i > 0; i-- {
+		if _, err := pool.Add(txs[i]); err != nil {
+			t.Fatal(err)
 		}
+	}
+	if pending, future := pool.Stats(); pending != 0 || future != len(txs)-1 || len(newTxs) != 0 {
+		t.Fatalf("%d pending, %d future", pending, future)
+	}
+	promoted, err := pool.AddRemote(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promoted) != len(txs) {
+		t.Fatalf("%d txs become pending", len(promoted))
+	}
+	if pending, future := pool.Stats(); pending != len(txs) || future != 0 {
+		t.Fatalf("future txs are not promoted: %d pending, %d future", pending, future)
+	}
+	if event := <-newTxs; len(event.Txs) != len(txs) {
+		t.Fatalf("%d txs in event", len(event.Txs))
+	}
+	if _, err := pool.Add(txs[1]); err != ErrKnownTx {
+		t.Fatalf("known tx, err %v", err)
+	}
 
-		success, err = txpool.Add(tx2_signed)
-		if !success {
-			fmt.Println(err)
+	// pending txs are in topological order, and stay in txpool until a
+	// canonical block includes them (e.g. mined block may not be inserted)
+	for n := 0; n < 2; n++ {
+		pending := pool.Pending()
+		if len(pending) != len(txs) {
+			t.Fatalf("%d pending txs", len(pending))
 		}
+		for i := range txs {
+			if pending[i].Hash != txs[i].Hash {
+				t.Fatalf("tx %d is not in order", i)
+			}
+		}
+	}
+
+	// chained txs are mined in a block, and removed from txpool
+	block := insertBlock(bc, pool.Pending()...)
+	if bc.CurrentBlock().Hash() != block.Hash() {
+		t.Fatal("block with chained txs is not inserted")
+	}
+	if len(pool.Pending()) != 0 {
+		t.Fatal("included txs are pending")
+	}
+	if !waitFor(func() bool { return pool.Len() == 0 }) {
+		t.Fatalf("%d included txs are left", pool.Len())
+	}
+}
+
+// futureTx makes tx between users i and j whose prev txs are unknown (n makes it unique)
+func (u *testUsers) futureTx(i, j int, n int) *types.Transaction {
+	keys := []*ecdsa.PublicKey{&u.keys[i].PublicKey, &u.keys[j].PublicKey}
+	prev := crypto.Keccak256Hash([]byte(fmt.Sprintf("unknown tx %d", n)))
+	tx := types.NewTransaction(keys, []*state.Account{state.NewAccount(keys[0], 1, 100), state.NewAccount(keys[1], 1, 100)}, []*common.Hash{&prev, &prev})
+	tx.Sign(u.keys[i])
+	tx.Sign(u.keys[j])
+	return tx
+}
 
-		success, err = txpool.Add(tx_insufficient_signed)
-		if !success {
-			fmt.Println(err)
+func TestTxPoolFutureLimits(t *testing.T) {
+	pairs := MaxFutureTxs/MaxAccountFutureTxs + 1
+	users := newTestUsers(2 * pairs)
+	pool := NewTxPool(users.newBlockChain())
+	defer pool.Stop()
+
+	// malformed tx is rejected before it waits in future
+	tx := users.futureTx(0, 1, 0)
+	tx.Signature_R = tx.Signature_R[:1]
+	if _, err := pool.Add(tx); err == nil {
+		t.Fatal("malformed future tx is added")
+	}
+
+	// account's oldest future tx is evicted
+	txs := types.Transactions{}
+	for n := 0; n <= MaxAccountFutureTxs; n++ {
+		tx := users.futureTx(0, 1, n)
+		if _, err := pool.Add(tx); err != nil {
+			t.Fatal(err)
 		}
-	*/
+		txs = append(txs, tx)
+	}
+	if _, future := pool.Stats(); future != MaxAccountFutureTxs || pool.Get(txs[0].Hash) != nil || pool.Get(txs[1].Hash) == nil {
+		t.Fatalf("%d future txs, the oldest is not evicted", future)
+	}
 
-	// [TODO] return false (not runtime error!) when the sign is invalid
-	success, err = txpool.Add(tx_sender_invalid_signed)
-	if !success {
-		fmt.Println(err)
+	// the oldest future tx is evicted when future is full
+	for i := 0; i <= MaxFutureTxs-MaxAccountFutureTxs; i++ {
+		pair := 1 + i/MaxAccountFutureTxs
+		if _, err := pool.Add(users.futureTx(2*pair, 2*pair+1, i)); err != nil {
+			t.Fatal(err)
+		}
 	}
+	if _, future := pool.Stats(); future != MaxFutureTxs || pool.Get(txs[1].Hash) != nil || pool.Get(txs[2].Hash) == nil {
+		t.Fatalf("%d future txs, the oldest is not evicted", future)
+	}
+}
 
-	// Mining from txpool
-	fmt.Println("============ Mining block  ============")
-	miner := miner.Miner{acc0.Address}
-	block := miner.Mine(txpool, 240)
-	if block != nil {
-		block.PrintTxs()
-	} else {
-		fmt.Println("Mining Fail")
+func TestTxPoolMissedReorg(t *testing.T) {
+	users := newTestUsers(4)
+	bc, fork := users.newBlockChain(), users.newBlockChain()
+	pool := NewTxPool(bc)
+	pool.Stop() // txpool misses all chain events below
+
+	txs := []*types.Transaction{users.transfer(0, 1, 10), users.transfer(2, 3, 10)}
+	for _, tx := range txs {
+		if _, err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insertBlock(bc, txs...)
+	for i := 0; i < 2; i++ {
+		if err := bc.Insert(insertBlock(fork)); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	// Add to Blockchain
-	err = bc.Insert(block)
-	if err != nil {
-		fmt.Println(err)
+	// reset from the last head still re-injects txs of the dropped block
+	pool.reset()
+	if pool.Len() != len(txs) {
+		t.Fatalf("%d txs are left (expected %d)", pool.Len(), len(txs))
 	}
+	if pool.head.Hash() != bc.CurrentBlock().Hash() {
+		t.Fatal("txpool is not reset on current head")
+	}
+}
 
-	//spew.Dump(bc)
-	bc.PrintBlockChain()
+func TestTxPoolPendingState(t *testing.T) {
+	users := newTestUsers(4)
+	bc := users.newBlockChain()
+	other := users.copy()
+	pool := NewTxPool(bc)
+	pool.Stop() // txpool is not reset on new heads below
+
+	txs := []*types.Transaction{users.transfer(0, 1, 10), users.transfer(2, 3, 10)}
+	for _, tx := range txs {
+		if _, err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
 
-	// output:
-	// true
+	// users 0 and 1 send another tx elsewhere, so their pending tx is skipped
+	insertBlock(bc, other.transfer(1, 0, 5))
+	pending := pool.Pending()
+	if len(pending) != 1 || pending[0].Hash != txs[1].Hash {
+		t.Fatalf("%d pending txs (expected 1)", len(pending))
+	}
+	if err := bc.Insert(mineBlock(bc, common.Address{}, pending)); err != nil {
+		t.Fatal(err)
+	}
 }
@@ -20,9 +20,18 @@ var (
 
 const (
 	InterlinkLength = uint64(10)
+
+	// HeaderVersion is the version of header encoding which new headers are made with.
+	// version 0 is legacy (go formatting of header), kept to verify headers in old databases.
+	// version 1 is canonical rlp encoding (see Header.CanonicalBytes)
+	HeaderVersion = uint64(1)
 )
 
+// two256 is a big integer representing 2^256
+var two256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
+
 type Header struct {
+	Version    uint64                  `json:"version"`    // encoding version which header's hash is computed with
 	ParentHash common.Hash             `json:"parentHash"` // previous block's hash
 	Coinbase   common.Address          `json:"miner"`
 	Root       common.Hash             `json:"stateRoot"`
@@ -31,7 +40,7 @@ type Header struct {
 	Time       uint64                  `json:"timestamp"`
 	Nonce      uint64                  `json:"nonce"`
 	InterLink  [InterlinkLength]uint64 `json:"interlink"`  // list of block's level
-	Difficulty uint64                  `json:"difficulty"` // no difficulty change, so set global Difficulty
+	Difficulty uint64                  `json:"difficulty"` // block's hash should be lower than 2^256 / Difficulty
 }
 
 type Body struct {
@@ -47,8 +56,88 @@ type Block struct {
 	size atomic.Value
 }
 
+// legacyHeader has fields of version 0 header, so its go formatting is same with old headers'
+type legacyHeader struct {
+	ParentHash common.Hash
+	Coinbase   common.Address
+	Root       common.Hash
+	TxHash     common.Hash
+	Number     uint64
+	Time       uint64
+	Nonce      uint64
+	InterLink  [InterlinkLength]uint64
+	Difficulty uint64
+}
+
+// Hash returns keccak256 hash of header's encoding (by header's version)
 func (h *Header) Hash() common.Hash {
-	return crypto.Keccak256Hash(common.ToBytes(*h))
+	if h.Version == 0 {
+		return crypto.Keccak256Hash(common.ToBytes(h.legacy()))
+	}
+	return crypto.Keccak256Hash(h.CanonicalBytes())
+}
+
+// CanonicalBytes returns canonical encoding of header (version 1)
+// rlp([version, parentHash, coinbase, root, txHash, number, time, nonce, [interlink], difficulty])
+// hashes and coinbase are byte strings, and the others are unsigned integers.
+func (h *Header) CanonicalBytes() []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{
+		h.Version,
+		h.ParentHash,
+		h.Coinbase,
+		h.Root,
+		h.TxHash,
+		h.Number,
+		h.Time,
+		h.Nonce,
+		h.InterLink[:],
+		h.Difficulty,
+	})
+	return enc
+}
+
+func (h *Header) legacy() legacyHeader {
+	return legacyHeader{
+		ParentHash: h.ParentHash,
+		Coinbase:   h.Coinbase,
+		Root:       h.Root,
+		TxHash:     h.TxHash,
+		Number:     h.Number,
+		Time:       h.Time,
+		Nonce:      h.Nonce,
+		InterLink:  h.InterLink,
+		Difficulty: h.Difficulty,
+	}
+}
+
+// DecodeLegacyHeader decodes rlp encoded header which was stored before
+// Header.Version field was added. decoded header has version 0.
+func DecodeLegacyHeader(data []byte) (*Header, error) {
+	var lh legacyHeader
+	if err := rlp.DecodeBytes(data, &lh); err != nil {
+		return nil, err
+	}
+	return &Header{
+		ParentHash: lh.ParentHash,
+		Coinbase:   lh.Coinbase,
+		Root:       lh.Root,
+		TxHash:     lh.TxHash,
+		Number:     lh.Number,
+		Time:       lh.Time,
+		Nonce:      lh.Nonce,
+		InterLink:  lh.InterLink,
+		Difficulty: lh.Difficulty,
+	}, nil
+}
+
+// Target returns PoW target of the header (2^256 / Difficulty)
+// header's hash should be lower than target
+func (h *Header) Target() *big.Int {
+	difficulty := h.Difficulty
+	if difficulty == 0 {
+		difficulty = 1
+	}
+	return new(big.Int).Div(two256, new(big.Int).SetUint64(difficulty))
 }
 
 // block's hash is same with header's hash
@@ -75,9 +164,8 @@ func (b *Block) InsertTx(tx *Transaction) {
 
 func (b *Block) GetLevel() uint64 {
 	var level uint64 = 0
-	//dif := core.Difficulty
-	//dif := big.NewInt(10000)
-	dif := common.Difficulty
+	// level is measured from the block's own target
+	dif := b.header.Target()
 	blockHash := b.Hash().ToBigInt()
 
 	for {
@@ -196,6 +284,7 @@ func NewBlock(header *Header, txs []*Transaction) *Block {
 
 func NewHeader(parentHash common.Hash, miner common.Address, stateRoot common.Hash, txHash common.Hash, difficulty uint64, number uint64, time uint64, nonce uint64) *Header {
 	return &Header{
+		Version:    HeaderVersion,
 		ParentHash: parentHash,
 		Coinbase:   miner,
 		Root:       stateRoot,
@@ -208,6 +297,7 @@ func NewHeader(parentHash common.Hash, miner common.Address, stateRoot common.Ha
 }
 func CopyHeader(header *Header) *Header {
 	return &Header{
+		Version:    header.Version,
 		ParentHash: header.ParentHash,
 		Coinbase:   header.Coinbase,
 		Root:       header.Root,
@@ -281,12 +371,17 @@ func (b *Block) Transactions() Transactions { return b.transactions }
 
 // block validation function for iot node
 func (b *Block) ValidateBlock() error {
-	// 1. check block_hash < difficulty
-	if b.GetHeader().Hash().ToBigInt().Cmp(common.Difficulty) != -1 {
+	// 1. check block_hash < target
+	if b.GetHeader().Hash().ToBigInt().Cmp(b.GetHeader().Target()) != -1 {
 		return errors.New("block's hash is higher than difficulty")
 	}
 
-	// 2. check block's txs validity
+	// 2. check block's tx root
+	if b.transactions.Hash() != b.header.TxHash {
+		return errors.New("block's tx root does not match with block's txs")
+	}
+
+	// 3. check block's txs validity
 	for i := 0; i < len(b.transactions); i++ {
 		err := b.transactions[i].ValidateTx()
 		if err != nil {
@@ -2,28 +2,30 @@ package types
 
 import (
 	"fmt"
+
+	"github.com/altair-lab/xoreum/core/state"
 )
 
-func ExampleFunc() {
+func ExampleBlock_ValidateBlock() {
 
+	s := state.NewAccounts()
 	txs := make(Transactions, 0)
-	txs.Insert(MakeTestSignedTx(2))
-	txs.Insert(MakeTestSignedTx(3))
+	txs.Insert(MakeTestSignedTx(2, s))
+	txs.Insert(MakeTestSignedTx(3, s))
 
 	b := NewBlock(&Header{
-		Nonce:  34211111,
-		Number: 651,
-		Time:   11111124273,
-		TxHash: txs.Hash(),
+		Nonce:      34211111,
+		Number:     651,
+		Time:       11111124273,
+		TxHash:     txs.Hash(),
+		Difficulty: 1,
 	}, txs)
 
-	fmt.Println(b)
-
-	fmt.Println(b.GetLevel())
+	fmt.Println(len(b.Transactions()))
 
 	fmt.Println(b.ValidateBlock())
 
-	b.PrintBlock()
-
-	// output: nil
+	// output:
+	// 2
+	// <nil>
 }
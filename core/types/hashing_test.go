@@ -0,0 +1,58 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core/state"
+	"github.com/altair-lab/xoreum/crypto"
+)
+
+func TestHeaderCanonicalBytes(t *testing.T) {
+	h := NewHeader(common.Hash{}, common.Address{}, common.Hash{}, common.Hash{}, 100, 1, 2, 3)
+	h.InterLink[0] = 5
+
+	want := "f894" + "01" +
+		"a0" + zeros(32) + // parent hash
+		"a0" + zeros(32) + // coinbase
+		"a0" + zeros(32) + // state root
+		"a0" + zeros(32) + // tx root
+		"010203" + // number, time, nonce
+		"ca05808080808080808080" + // interlink
+		"64" // difficulty
+	if have := hex.EncodeToString(h.CanonicalBytes()); have != want {
+		t.Fatalf("canonical header encoding mismatch\nhave %s\nwant %s", have, want)
+	}
+	if h.Hash() != crypto.Keccak256Hash(h.CanonicalBytes()) {
+		t.Fatal("header hash is not keccak256 of canonical encoding")
+	}
+}
+
+func TestTxCanonicalBytes(t *testing.T) {
+	tx := MakeTestSignedTx(2, state.NewAccounts())
+	enc := tx.Data.CanonicalBytes()
+
+	// public key coordinates are always 32 bytes, even if they have leading zeros
+	for _, key := range tx.Data.Participants {
+		x := make([]byte, 32)
+		copy(x[32-len(key.X.Bytes()):], key.X.Bytes())
+		if !bytes.Contains(enc, append([]byte{0xa0}, x...)) {
+			t.Fatal("public key coordinate is not encoded as 32 bytes")
+		}
+	}
+	if err := tx.VerifySignature(); err != nil {
+		t.Fatal(err)
+	}
+
+	// legacy tx keeps go formatting hash
+	tx.Data.Version = 0
+	if tx.GetHash() != crypto.Keccak256Hash(crypto.Keccak256(tx.Data.legacyBytes())) {
+		t.Fatal("legacy tx hash changed")
+	}
+}
+
+func zeros(n int) string {
+	return hex.EncodeToString(make([]byte, n))
+}
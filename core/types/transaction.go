@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"math/bits"
 	"reflect"
 
 	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/common/math"
 	"github.com/altair-lab/xoreum/core/state"
 	"github.com/altair-lab/xoreum/crypto"
 	"github.com/altair-lab/xoreum/rlp"
@@ -22,8 +25,23 @@ var (
 	ErrInvalidPostStates = errors.New("tx's PostStates's Account is not same with tx's Participants")
 
 	ErrInvalidPrevTxHashes = errors.New("Account in tx's PrevTxHashes is not match with Participants")
+
+	ErrUnknownPrevTx = errors.New("tx's prev tx is not found")
+
+	ErrUnknownTxVersion = errors.New("tx has unknown encoding version")
+
+	ErrBalanceOverflow = errors.New("tx's balance sum overflows uint64")
+
+	ErrDuplicateParticipant = errors.New("tx has the same participant more than once")
+
+	ErrUnbalancedTx = errors.New("tx's prev/post balance sum is different")
 )
 
+// TxLookup resolves a tx by its hash (e.g. from db), used to load prev states
+type TxLookup interface {
+	GetTransaction(hash common.Hash) *Transaction
+}
+
 type Transaction struct {
 	Data Txdata      `json:"d"`
 	Hash common.Hash `json:"h"`
@@ -45,8 +63,15 @@ func (txs AllTxs) Print() {
 	}
 }
 
+// TxVersion is the version of txdata encoding which new txs are made with.
+// version 0 is legacy (go formatting of fields), kept to verify txs in old databases.
+// version 1 is canonical rlp encoding (see Txdata.CanonicalBytes)
+const TxVersion = uint64(1)
+
 // simple implementation
 type Txdata struct {
+	Version uint64 `json:"version"` // encoding version which tx's hash is computed with
+
 	// new version fields
 	Participants []*ecdsa.PublicKey `json:"participants"`
 	PostStates   []*state.Account   `json:"poststates"`
@@ -55,6 +80,7 @@ type Txdata struct {
 
 func NewTransaction(participants []*ecdsa.PublicKey, postStates []*state.Account, prevTxHashes []*common.Hash) *Transaction {
 	d := Txdata{
+		Version:      TxVersion,
 		Participants: participants,
 		PostStates:   postStates,
 		PrevTxHashes: prevTxHashes,
@@ -141,23 +167,68 @@ func (tx *Transaction) GetPostStateByAddress(key []byte) *state.Account {
 	return nil
 }
 
-func (tx *Transaction) GetPostBalanceSum() uint64 {
+// GetPostBalanceSum returns the sum of participants' post balances
+func (tx *Transaction) GetPostBalanceSum() (uint64, error) {
 	sum := uint64(0)
 	for _, s := range tx.Data.PostStates {
-		sum += s.Balance
+		var carry uint64
+		if sum, carry = bits.Add64(sum, s.Balance, 0); carry != 0 {
+			return 0, ErrBalanceOverflow
+		}
 	}
-	return sum
+	return sum, nil
 }
 
-func (tx *Transaction) GetPrevBalanceSum() uint64 {
+// GetPrevState returns i-th participant's post state in its prev tx.
+// participant without prev tx (empty hash) has empty account.
+func (tx *Transaction) GetPrevState(lookup TxLookup, i int) (*state.Account, error) {
+	key := tx.Data.Participants[i]
+	prevHash := *tx.Data.PrevTxHashes[i]
+	if prevHash == (common.Hash{}) {
+		return state.NewAccount(key, 0, 0), nil
+	}
+
+	prevTx := lookup.GetTransaction(prevHash)
+	if prevTx == nil {
+		return nil, ErrUnknownPrevTx
+	}
+	prevState := prevTx.GetPostState(key)
+	if prevState == nil {
+		return nil, ErrInvalidPrevTxHashes
+	}
+	return prevState, nil
+}
+
+// GetPrevBalanceSum returns the sum of participants' balances in their prev txs
+func (tx *Transaction) GetPrevBalanceSum(lookup TxLookup) (uint64, error) {
 	sum := uint64(0)
-	for i, _ := range tx.Data.Participants {
-		//[FIXME]
-		//prevState := loadTransaction(tx.Data.PrevTxHashes[i]).GetPostState()
-		prevState := &state.Account{Balance: uint64(i)}
-		sum += prevState.Balance
+	for i := range tx.Data.Participants {
+		prevState, err := tx.GetPrevState(lookup, i)
+		if err != nil {
+			return 0, err
+		}
+		var carry uint64
+		if sum, carry = bits.Add64(sum, prevState.Balance, 0); carry != 0 {
+			return 0, ErrBalanceOverflow
+		}
 	}
-	return sum
+	return sum, nil
+}
+
+// CheckBalanceSum checks that tx conserves balance (prev sum == post sum)
+func (tx *Transaction) CheckBalanceSum(lookup TxLookup) error {
+	prevSum, err := tx.GetPrevBalanceSum(lookup)
+	if err != nil {
+		return err
+	}
+	postSum, err := tx.GetPostBalanceSum()
+	if err != nil {
+		return err
+	}
+	if prevSum != postSum {
+		return ErrUnbalancedTx
+	}
+	return nil
 }
 
 //func (tx *Transaction) Value() uint64 { return tx.Data.Amount }
@@ -170,9 +241,102 @@ func (tx *Transaction) Participants() []*ecdsa.PublicKey { return tx.Data.Partic
 func (tx *Transaction) PostStates() []*state.Account     { return tx.Data.PostStates }
 func (tx *Transaction) PrevTxHashes() []*common.Hash     { return tx.Data.PrevTxHashes }
 
-// get hashed txdata's byte array
+// get hashed txdata's byte array (which participants sign)
 func (data *Txdata) GetHashedBytes() []byte {
+	if data.Version == 0 {
+		return crypto.Keccak256(data.legacyBytes())
+	}
+	return crypto.Keccak256(data.CanonicalBytes())
+}
+
+// CanonicalBytes returns canonical encoding of txdata (version 1)
+// rlp([version, [[x, y, nonce, balance, prevTxHash], ...]])
+// x and y are participant's public key coordinates as 32 byte big endian.
+func (data *Txdata) CanonicalBytes() []byte {
+	enc, _ := rlp.EncodeToBytes(data.toRlp())
+	return enc
+}
+
+// rlpTxdata is rlp form of txdata (same with canonical encoding)
+type rlpTxdata struct {
+	Version      uint64
+	Participants []rlpParticipant
+}
+
+type rlpParticipant struct {
+	X, Y       []byte // 32 byte big endian
+	Nonce      uint64
+	Balance    uint64
+	PrevTxHash common.Hash
+}
 
+// rlpTransaction is rlp form of tx, which is used in network protocol
+type rlpTransaction struct {
+	Data        rlpTxdata
+	Signature_R []*big.Int
+	Signature_S []*big.Int
+}
+
+func (data *Txdata) toRlp() rlpTxdata {
+	enc := rlpTxdata{Version: data.Version, Participants: make([]rlpParticipant, len(data.Participants))}
+	for i := 0; i < len(data.Participants); i++ {
+		enc.Participants[i] = rlpParticipant{
+			X:          math.PaddedBigBytes(data.Participants[i].X, 32),
+			Y:          math.PaddedBigBytes(data.Participants[i].Y, 32),
+			Nonce:      data.PostStates[i].Nonce,
+			Balance:    data.PostStates[i].Balance,
+			PrevTxHash: *data.PrevTxHashes[i],
+		}
+	}
+	return enc
+}
+
+// EncodeRLP implements rlp.Encoder
+func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, rlpTransaction{
+		Data:        tx.Data.toRlp(),
+		Signature_R: tx.Signature_R,
+		Signature_S: tx.Signature_S,
+	})
+}
+
+// DecodeRLP implements rlp.Decoder. tx's hash is recomputed from decoded txdata.
+func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
+	var dec rlpTransaction
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+
+	length := len(dec.Data.Participants)
+	if len(dec.Signature_R) != length || len(dec.Signature_S) != length {
+		return ErrDiffFieldLength
+	}
+	data := Txdata{
+		Version:      dec.Data.Version,
+		Participants: make([]*ecdsa.PublicKey, length),
+		PostStates:   make([]*state.Account, length),
+		PrevTxHashes: make([]*common.Hash, length),
+	}
+	for i, p := range dec.Data.Participants {
+		prevTxHash := p.PrevTxHash
+		data.Participants[i] = &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(p.X),
+			Y:     new(big.Int).SetBytes(p.Y),
+		}
+		data.PostStates[i] = &state.Account{PublicKey: data.Participants[i], Nonce: p.Nonce, Balance: p.Balance}
+		data.PrevTxHashes[i] = &prevTxHash
+	}
+
+	tx.Data = data
+	tx.Signature_R = dec.Signature_R
+	tx.Signature_S = dec.Signature_S
+	tx.Hash = tx.GetHash()
+	return nil
+}
+
+// legacyBytes returns go formatting of txdata (version 0)
+func (data *Txdata) legacyBytes() []byte {
 	bytelist := []byte{}
 	for i := 0; i < len(data.Participants); i++ {
 		bytelist = append(bytelist, common.ToBytes(data.Participants[i].X)...)
@@ -181,8 +345,7 @@ func (data *Txdata) GetHashedBytes() []byte {
 		bytelist = append(bytelist, common.ToBytes(data.PostStates[i].Balance)...)
 		bytelist = append(bytelist, common.ToBytes(*data.PrevTxHashes[i])...)
 	}
-
-	return crypto.Keccak256(bytelist)
+	return bytelist
 }
 
 // hashing txdata of tx
@@ -193,19 +356,9 @@ func (tx *Transaction) GetHash() common.Hash {
 	return crypto.Keccak256Hash(tx.Data.GetHashedBytes())
 }
 
-// hashing all transactions in txs (temporary)
-// TODO: this hash value should be root value of tx's merkle tree
+// Hash returns the merkle root of txs (see DeriveSha), which goes into Header.TxHash
 func (txs Transactions) Hash() common.Hash {
-
-	//return crypto.Keccak256Hash(common.ToBytes(*txs))
-
-	// new method
-	bytelist := []byte{}
-	for i := 0; i < len(txs); i++ {
-		bytelist = append(bytelist, txs[i].Data.GetHashedBytes()...)
-	}
-
-	return crypto.Keccak256Hash(bytelist)
+	return DeriveSha(txs)
 }
 
 // insert tx into txs
@@ -292,6 +445,8 @@ func MakeTestSignedTx(participantsNum int, s state.Accounts) *Transaction {
 func (s Transactions) Len() int { return len(s) }
 
 // GetRlp implements Rlpable and returns the i'th element of s in rlp.
+// the leaf is tx's canonical encoding (see EncodeRLP), so that tx root
+// commits to signatures as well as txdata.
 func (s Transactions) GetRlp(i int) []byte {
 	enc, _ := rlp.EncodeToBytes(s[i])
 	return enc
@@ -300,20 +455,41 @@ func (s Transactions) GetRlp(i int) []byte {
 // tx validation function for iot node
 func (tx *Transaction) ValidateTx() error {
 
+	// 0. check tx's encoding version is known
+	if tx.Data.Version > TxVersion {
+		return ErrUnknownTxVersion
+	}
+
 	// 1. check Participants, PostStates, PrevTxHashes's lengths are same
 	if !(len(tx.Data.Participants) == len(tx.Data.PostStates) && len(tx.Data.PostStates) == len(tx.Data.PrevTxHashes)) {
 		return ErrDiffFieldLength
 	}
 
-	// 2. check PostStates' Account == Participants' Account (check pub key)
+	if len(tx.Signature_R) != len(tx.Data.Participants) || len(tx.Signature_S) != len(tx.Data.Participants) {
+		return ErrDiffFieldLength
+	}
+
+	// 2. check every field is filled, and a participant appears only once
+	// (otherwise a participant's prev state could be spent twice)
+	participants := make(map[common.Address]bool)
+	for i := 0; i < len(tx.Data.Participants); i++ {
+		if tx.Data.Participants[i] == nil || tx.Data.PostStates[i] == nil || tx.Data.PostStates[i].PublicKey == nil || tx.Data.PrevTxHashes[i] == nil {
+			return ErrNoFields
+		}
+		address := crypto.PubkeyToAddress(tx.Data.Participants[i])
+		if participants[address] {
+			return ErrDuplicateParticipant
+		}
+		participants[address] = true
+	}
+
+	// 3. check PostStates' Account == Participants' Account (check pub key)
 	for i := 0; i < len(tx.Data.Participants); i++ {
 		if *tx.Data.PostStates[i].PublicKey != *tx.Data.Participants[i] {
 			return ErrInvalidPostStates
 		}
 	}
 
-	// 3. check PrevTxHashes has Participants state (TODO) -> ErrInvalidPrevTxHashes
-
 	// 4. check signature
 	return tx.VerifySignature()
 }
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/rlp"
+	"github.com/altair-lab/xoreum/trie"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+var (
+	ErrTxNotInBlock   = errors.New("tx is not included in the block")
+	ErrInvalidTxProof = errors.New("tx inclusion proof does not match with tx root")
+)
+
+// TxProof is a merkle proof that a tx sits at Index in a block's tx trie
+// (whose root is Header.TxHash). Nodes are rlp encoded trie nodes from root to leaf.
+type TxProof struct {
+	Index uint     `json:"index"`
+	Nodes [][]byte `json:"nodes"`
+}
+
+// proofList collects trie nodes written by trie.Prove
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+func (n *proofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// txTrieKey returns the key of index-th tx in tx trie (same as DeriveSha)
+func txTrieKey(index uint) []byte {
+	keybuf := new(bytes.Buffer)
+	rlp.Encode(keybuf, index)
+	return keybuf.Bytes()
+}
+
+// ProveTx returns a merkle proof for the tx with given hash in b's txs
+func (b *Block) ProveTx(hash common.Hash) (*TxProof, error) {
+	for i, tx := range b.transactions {
+		if tx.GetHash() == hash {
+			return ProveTxAt(b.transactions, uint(i))
+		}
+	}
+	return nil, ErrTxNotInBlock
+}
+
+// ProveTxAt returns a merkle proof for index-th tx in txs
+func ProveTxAt(txs Transactions, index uint) (*TxProof, error) {
+	if index >= uint(txs.Len()) {
+		return nil, ErrTxNotInBlock
+	}
+
+	t := new(trie.Trie)
+	for i := 0; i < txs.Len(); i++ {
+		t.Update(txTrieKey(uint(i)), txs.GetRlp(i))
+	}
+
+	var nodes proofList
+	if err := t.Prove(txTrieKey(index), 0, &nodes); err != nil {
+		return nil, err
+	}
+	return &TxProof{Index: index, Nodes: nodes}, nil
+}
+
+// VerifyTxProof checks that tx (with its signatures) sits in the block of
+// given header with the proof
+func VerifyTxProof(header *Header, tx *Transaction, proof *TxProof) error {
+	leaf, err := proof.Verify(header.TxHash)
+	if err != nil {
+		return err
+	}
+	enc, err := rlp.EncodeToBytes(tx)
+	if err != nil || !bytes.Equal(leaf, enc) {
+		return ErrInvalidTxProof
+	}
+	return nil
+}
+
+// Verify checks the proof against tx root and returns the proven leaf
+// (tx's canonical encoding, see Transactions.GetRlp)
+func (p *TxProof) Verify(root common.Hash) ([]byte, error) {
+	db := memorydb.New()
+	for _, node := range p.Nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+
+	value, _, err := trie.VerifyProof(root, txTrieKey(p.Index), db)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, ErrTxNotInBlock
+	}
+	return value, nil
+}
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/altair-lab/xoreum/core/state"
+)
+
+func TestTxProof(t *testing.T) {
+	accounts := state.NewAccounts()
+	txs := make(Transactions, 0)
+	for i := 0; i < 20; i++ {
+		txs.Insert(MakeTestSignedTx(2, accounts))
+	}
+	b := NewBlock(&Header{TxHash: txs.Hash()}, txs)
+
+	for i, tx := range txs {
+		proof, err := b.ProveTx(tx.GetHash())
+		if err != nil {
+			t.Fatalf("tx %d: failed to prove: %v", i, err)
+		}
+		if err := VerifyTxProof(b.Header(), tx, proof); err != nil {
+			t.Fatalf("tx %d: failed to verify: %v", i, err)
+		}
+		// proof of a tx must not prove other txs
+		if err := VerifyTxProof(b.Header(), txs[(i+1)%len(txs)], proof); err != ErrInvalidTxProof {
+			t.Fatalf("tx %d: proved wrong tx, err %v", i, err)
+		}
+		// nor the same txdata with other signatures
+		forged := &Transaction{Data: tx.Data, Hash: tx.Hash, Signature_R: tx.Signature_S, Signature_S: tx.Signature_R}
+		if err := VerifyTxProof(b.Header(), forged, proof); err != ErrInvalidTxProof {
+			t.Fatalf("tx %d: proved tx with wrong signatures, err %v", i, err)
+		}
+	}
+
+	if _, err := b.ProveTx(MakeTestSignedTx(2, accounts).GetHash()); err != ErrTxNotInBlock {
+		t.Fatalf("proved unknown tx, err %v", err)
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"strings"
 
 	"github.com/altair-lab/xoreum/common"
 	"golang.org/x/crypto/sha3"
@@ -42,11 +47,51 @@ func Keccak256Address(data ...[]byte) (a common.Address) {
 	return a
 }
 
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
 // generate random private key
 func GenerateKey() (*ecdsa.PrivateKey, error) {
 	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 }
 
+// ToECDSA makes private key of d (big endian scalar on P-256 curve)
+func ToECDSA(d []byte) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	if priv.D.Sign() <= 0 || priv.D.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	priv.PublicKey.Curve = curve
+	priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(d)
+	return priv, nil
+}
+
+// FromECDSA returns private key's scalar (32 bytes, big endian)
+func FromECDSA(priv *ecdsa.PrivateKey) []byte {
+	d := make([]byte, 32)
+	b := priv.D.Bytes()
+	copy(d[32-len(b):], b)
+	return d
+}
+
+// LoadECDSA loads hex encoded private key from file
+func LoadECDSA(file string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	d, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return ToECDSA(d)
+}
+
+// SaveECDSA saves private key into file in hex (readable only by owner)
+func SaveECDSA(file string, priv *ecdsa.PrivateKey) error {
+	return ioutil.WriteFile(file, []byte(hex.EncodeToString(FromECDSA(priv))), 0600)
+}
+
 // Pubkey to address
 func PubkeyToAddress(pubkey *ecdsa.PublicKey) common.Address {
 	x := common.ToBytes(*pubkey.X)
@@ -468,7 +468,7 @@ func TransformBitcoinData(targetBlockNum int, rpc *Bitcoind) *core.BlockChain {
 		}
 
 		// mining xoreum block
-		b := Miner.Mine(Txpool, uint64(0))
+		b := Miner.Mine(Txpool)
 		if b == nil {
 			fmt.Println("Mining Fail")
 		}
@@ -0,0 +1,141 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/altair-lab/xoreum/rlp"
+)
+
+const (
+	// MaxMsgSize is the maximum size of a message (code and payload)
+	MaxMsgSize = 16 * 1024 * 1024
+
+	DefaultDialTimeout  = 10 * time.Second
+	DefaultReadTimeout  = 30 * time.Second // waiting for a message (e.g. response)
+	DefaultWriteTimeout = 20 * time.Second
+)
+
+var (
+	ErrMsgTooLarge = errors.New("message is larger than maximum size")
+
+	ErrEmptyMsg = errors.New("message has no code")
+)
+
+// Conn is a framed connection with a peer
+// frame: [length (4 bytes, little endian)][code (1 byte)][rlp encoded payload]
+// length covers code and payload. reads and writes are safe for concurrent use.
+type Conn struct {
+	conn net.Conn
+
+	rmu sync.Mutex // lock for reading a frame
+	wmu sync.Mutex // lock for writing a frame
+
+	pmu   sync.Mutex // lock for phase
+	phase string     // phase of last request, which messages are counted in (see stats.go)
+
+	readTimeout  time.Duration // 0 means no deadline
+	writeTimeout time.Duration // 0 means no deadline
+	maxMsgSize   uint32
+}
+
+// NewConn wraps conn with default timeouts and message size limit
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn:         conn,
+		readTimeout:  DefaultReadTimeout,
+		writeTimeout: DefaultWriteTimeout,
+		maxMsgSize:   MaxMsgSize,
+	}
+}
+
+// Dial connects to addr
+func Dial(addr string) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, DefaultDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn), nil
+}
+
+// SetReadTimeout sets how long ReadMsg waits for a message (0: forever)
+func (c *Conn) SetReadTimeout(timeout time.Duration) { c.readTimeout = timeout }
+
+// SetWriteTimeout sets how long WriteMsg waits for sending a message (0: forever)
+func (c *Conn) SetWriteTimeout(timeout time.Duration) { c.writeTimeout = timeout }
+
+// SetMaxMsgSize sets the maximum size of a message which can be read or written
+func (c *Conn) SetMaxMsgSize(size uint32) { c.maxMsgSize = size }
+
+func (c *Conn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+func (c *Conn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+func (c *Conn) Close() error { return c.conn.Close() }
+
+// WriteMsg sends a message with rlp encoded data
+func (c *Conn) WriteMsg(code uint64, data interface{}) error {
+	payload, err := rlp.EncodeToBytes(data)
+	if err != nil {
+		return err
+	}
+	if uint64(len(payload))+1 > uint64(c.maxMsgSize) {
+		return ErrMsgTooLarge
+	}
+
+	frame := make([]byte, 5+len(payload))
+	binary.LittleEndian.PutUint32(frame, uint32(1+len(payload)))
+	frame[4] = byte(code)
+	copy(frame[5:], payload)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.conn.SetWriteDeadline(deadline(c.writeTimeout)); err != nil {
+		return err
+	}
+	if _, err = c.conn.Write(frame); err != nil {
+		return err
+	}
+	c.countMsg(code, len(frame), true)
+	return nil
+}
+
+// ReadMsg receives a message. the whole frame is read even if it arrives in pieces.
+func (c *Conn) ReadMsg() (Msg, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if err := c.conn.SetReadDeadline(deadline(c.readTimeout)); err != nil {
+		return Msg{}, err
+	}
+
+	lengthBuf := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, lengthBuf); err != nil {
+		return Msg{}, err
+	}
+	length := binary.LittleEndian.Uint32(lengthBuf)
+	if length == 0 {
+		return Msg{}, ErrEmptyMsg
+	}
+	if length > c.maxMsgSize {
+		return Msg{}, ErrMsgTooLarge
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return Msg{}, err
+	}
+	c.countMsg(uint64(buf[0]), 4+len(buf), false)
+	return Msg{Code: uint64(buf[0]), Payload: buf[1:]}, nil
+}
+
+// deadline returns the deadline after timeout (zero time if no timeout)
+func deadline(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
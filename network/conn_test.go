@@ -0,0 +1,69 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnFragmentedFrame(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewConn(server)
+
+	// frame of GetBlocksMsg arrives byte by byte
+	go func() {
+		buf := new(bytes.Buffer)
+		w := NewConn(&bufConn{Conn: client, buf: buf})
+		w.WriteMsg(GetBlocksMsg, &GetBlocksData{Numbers: []uint64{1, 2, 3}})
+		for _, b := range buf.Bytes() {
+			client.Write([]byte{b})
+		}
+	}()
+
+	msg, err := conn.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req GetBlocksData
+	if msg.Code != GetBlocksMsg || msg.Decode(&req) != nil || len(req.Numbers) != 3 {
+		t.Fatalf("wrong message: %+v", msg)
+	}
+}
+
+func TestConnLimits(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	reader, writer := NewConn(server), NewConn(client)
+
+	reader.SetMaxMsgSize(8)
+	go writer.WriteMsg(GetBlocksMsg, &GetBlocksData{Numbers: []uint64{1, 2, 3, 4, 5, 6, 7, 8}})
+	if _, err := reader.ReadMsg(); err != ErrMsgTooLarge {
+		t.Fatalf("read too large message, err %v", err)
+	}
+
+	writer.SetMaxMsgSize(8)
+	if err := writer.WriteMsg(GetBlocksMsg, &GetBlocksData{Numbers: []uint64{1, 2, 3, 4, 5, 6, 7, 8}}); err != ErrMsgTooLarge {
+		t.Fatalf("wrote too large message, err %v", err)
+	}
+
+	// stream is broken after too large message, so wait on a new one
+	client, server = net.Pipe()
+	defer client.Close()
+	reader = NewConn(server)
+	reader.SetReadTimeout(10 * time.Millisecond)
+	if _, err := reader.ReadMsg(); err == nil {
+		t.Fatal("read without message")
+	} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("expected timeout, err %v", err)
+	}
+}
+
+// bufConn writes into buf instead of the connection
+type bufConn struct {
+	net.Conn
+	buf *bytes.Buffer
+}
+
+func (c *bufConn) Write(b []byte) (int, error) { return c.buf.Write(b) }
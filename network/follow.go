@@ -0,0 +1,171 @@
+package network
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/xordb"
+)
+
+var ErrHeaderLinkMismatch = errors.New("received headers are not linked to the head")
+
+// Broadcaster pushes new blocks to subscribed peers (full node side)
+type Broadcaster struct {
+	mu    sync.Mutex
+	peers map[*Conn]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{peers: make(map[*Conn]struct{})}
+}
+
+// Subscribe adds peer, and sends current head block to it
+// (so that peer can find blocks which it missed)
+func (b *Broadcaster) Subscribe(c *Conn, bc *core.BlockChain) error {
+	b.mu.Lock()
+	b.peers[c] = struct{}{}
+	b.mu.Unlock()
+
+	head := bc.CurrentBlock()
+	return c.WriteMsg(NewBlockMsg, &NewBlockData{Block: head, TD: bc.GetTd(head.Hash(), head.Number())})
+}
+
+func (b *Broadcaster) Unsubscribe(c *Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.peers, c)
+}
+
+// Broadcast sends block to all subscribed peers. peer which fails to
+// receive it is disconnected.
+func (b *Broadcaster) Broadcast(block *types.Block, td *big.Int) {
+	b.mu.Lock()
+	peers := make([]*Conn, 0, len(b.peers))
+	for c := range b.peers {
+		peers = append(peers, c)
+	}
+	b.mu.Unlock()
+
+	data := &NewBlockData{Block: block, TD: td}
+	for _, c := range peers {
+		if err := c.WriteMsg(NewBlockMsg, data); err != nil {
+			log.Printf("failed to push block to %v; err: %v", c.RemoteAddr(), err)
+			b.Unsubscribe(c)
+			c.Close()
+		}
+	}
+}
+
+// Follow subscribes to new blocks of full node, and inserts them into light
+// blockchain until connection is lost. blocks between light node's head and
+// received block are requested. inserted is called after each block is
+// inserted and blockchain's genesis is updated.
+func Follow(c *Conn, bc *core.BlockChain, inserted func(*types.Block)) error {
+	if err := c.WriteMsg(SubscribeMsg, struct{}{}); err != nil {
+		return err
+	}
+
+	pending := make(map[uint64]*types.Block) // received blocks ahead of head
+	requested := false                       // missing blocks are requested
+	for {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			return err
+		}
+
+		var blocks []*types.Block
+		switch msg.Code {
+		case NewBlockMsg:
+			var data NewBlockData
+			if err := msg.Decode(&data); err != nil {
+				return err
+			}
+			blocks = append(blocks, data.Block)
+		case BlocksMsg:
+			if err := msg.Decode(&blocks); err != nil {
+				return err
+			}
+			requested = false
+		default:
+			return ErrUnexpectedMsg
+		}
+		for _, block := range blocks {
+			pending[block.Number()] = block
+		}
+
+		// insert blocks in order
+		head := bc.CurrentBlock().Number()
+		for block, ok := pending[head+1]; ok; block, ok = pending[head+1] {
+			if err := bc.Insert(block); err != nil {
+				return err
+			}
+			bc.UpdateIoTGenesis()
+			inserted(block)
+			head++
+		}
+		for number := range pending {
+			if number <= head {
+				delete(pending, number)
+			}
+		}
+
+		// request missing blocks before the oldest pending block
+		if len(pending) == 0 || requested {
+			continue
+		}
+		numbers := []uint64{}
+		for number := head + 1; pending[number] == nil && len(numbers) < MaxBlocksServe; number++ {
+			numbers = append(numbers, number)
+		}
+		if err := c.WriteMsg(GetBlocksMsg, &GetBlocksData{Numbers: numbers}); err != nil {
+			return err
+		}
+		requested = true
+	}
+}
+
+// SyncEpochHeaders requests headers before head in its difficulty epoch
+// (RetargetInterval - 1 headers), and writes them into db. light node
+// needs them to check difficulty retargeting of following blocks.
+func SyncEpochHeaders(c *Conn, db xordb.Database, head *types.Header) error {
+	defer Measure(PhaseHeaders)()
+	if head.Number == 0 {
+		return nil
+	}
+	amount := params.RetargetInterval - 1
+	if head.Number <= amount {
+		amount = head.Number - 1
+	}
+	if amount == 0 {
+		return nil
+	}
+
+	var headers []*types.Header
+	req := &GetHeadersData{Origin: head.Number - amount, Amount: amount}
+	if err := Request(c, GetHeadersMsg, req, HeadersMsg, &headers); err != nil {
+		return err
+	}
+	if uint64(len(headers)) != amount {
+		return ErrHeaderLinkMismatch
+	}
+
+	// headers should be linked to head by parent hash
+	next := head
+	for i := len(headers) - 1; i >= 0; i-- {
+		if headers[i].Hash() != next.ParentHash || headers[i].Number+1 != next.Number {
+			return ErrHeaderLinkMismatch
+		}
+		next = headers[i]
+	}
+	for _, header := range headers {
+		rawdb.WriteHash(db, header.Hash(), header.Number)
+		rawdb.WriteHeader(db, header)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package network
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/state"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+func TestFollow(t *testing.T) {
+	full := NewTestChain(core.NewBlockChain(memorydb.New()), 10)
+	for i := 0; i < 15; i++ {
+		full.MineBlock(false)
+	}
+	bc := full.Blockchain
+	broadcaster := NewBroadcaster()
+	client, server := newPipe()
+	defer client.Close()
+	go serve(server, bc, broadcaster)
+
+	// synchronize light node with current block
+	status := &StatusData{ProtocolVersion: ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+	if _, err := Handshake(client, status); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	var blocks []*types.Block
+	if err := Request(client, GetInterlinksMsg, &GetInterlinksData{}, BlocksMsg, &blocks); err != nil {
+		t.Fatal(err)
+	}
+	head := blocks[len(blocks)-1]
+	db := memorydb.New()
+	if err := SyncState(client, db, head.Header()); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	if err := SyncEpochHeaders(client, db, head.Header()); err != nil {
+		t.Fatalf("failed to sync epoch headers: %v", err)
+	}
+	light := core.NewIoTBlockChain(db, head)
+
+	// full node keeps mining (over difficulty retargeting) while light node follows
+	inserted := make(chan *types.Block, 100)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Follow(client, light, func(block *types.Block) { inserted <- block })
+	}()
+	for i := 0; i < 10; i++ {
+		if block := full.MineBlock(false); block != nil {
+			broadcaster.Broadcast(block, bc.GetTd(block.Hash(), block.Number()))
+		}
+	}
+
+	timeout := time.After(10 * time.Second)
+	for number := head.Number(); number < bc.CurrentBlock().Number(); {
+		select {
+		case block := <-inserted:
+			number = block.Number()
+		case err := <-errc:
+			t.Fatalf("light node stopped following at block %d: %v", number, err)
+		case <-timeout:
+			t.Fatalf("light node is stuck at block %d", number)
+		}
+	}
+	if light.CurrentBlock().Hash() != bc.CurrentBlock().Hash() || light.StateRoot() != bc.StateRoot() {
+		t.Fatal("light node's head does not match with full node")
+	}
+	if light.Genesis().Hash() != bc.CurrentBlock().Hash() {
+		t.Fatal("light node's genesis is not updated")
+	}
+
+	// old blocks are deleted except interlink blocks
+	interlink := make(map[uint64]bool)
+	for _, number := range light.CurrentHeader().InterLink {
+		interlink[number] = true
+	}
+	for number := head.Number(); number+params.RetargetInterval <= light.CurrentBlock().Number(); number++ {
+		if !interlink[number] && light.GetHeaderByNumber(number) != nil {
+			t.Fatalf("old block %d is not deleted", number)
+		}
+	}
+}
+
+func TestSyncDelta(t *testing.T) {
+	full := NewTestChain(core.NewBlockChain(memorydb.New()), 10)
+	for i := 0; i < 15; i++ {
+		full.MineBlock(false)
+	}
+	bc := full.Blockchain
+	client, server := newPipe()
+	defer client.Close()
+	go serve(server, bc, nil)
+
+	status := &StatusData{ProtocolVersion: ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+	if _, err := Handshake(client, status); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	db := memorydb.New()
+	if err := SyncState(client, db, bc.CurrentHeader()); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	light := core.NewIoTBlockChain(db, bc.CurrentBlock())
+	if err := SyncEpochHeaders(client, db, light.CurrentHeader()); err != nil {
+		t.Fatalf("failed to sync epoch headers: %v", err)
+	}
+
+	// light node is offline while full node mines blocks
+	for i := 0; i < 15; i++ {
+		full.MineBlock(false)
+	}
+	if err := SyncDelta(client, light); err != nil {
+		t.Fatalf("failed to sync delta: %v", err)
+	}
+	if light.CurrentBlock().Hash() != bc.CurrentBlock().Hash() || light.Genesis().Hash() != bc.CurrentBlock().Hash() {
+		t.Fatal("light node's head is not moved to full node's current block")
+	}
+	if light.StateRoot() != bc.StateRoot() {
+		t.Fatal("synchronized state root mismatch")
+	}
+
+	// light node can follow next blocks from the new head
+	block := full.MineBlock(false)
+	for block == nil {
+		block = full.MineBlock(false)
+	}
+	if err := light.Insert(block); err != nil {
+		t.Fatalf("failed to insert next block: %v", err)
+	}
+
+	// unknown head
+	var delta DeltaData
+	if err := Request(client, GetDeltaMsg, &GetDeltaData{HeadNumber: 3}, DeltaMsg, &delta); err != nil || len(delta.Blocks) != 0 {
+		t.Fatalf("delta from unknown head, err %v", err)
+	}
+}
+
+func TestSyncProof(t *testing.T) {
+	// light node is synchronized with the other chain (which has one more user),
+	// so its head is not in full node's chain
+	other := NewTestChain(core.NewBlockChain(memorydb.New()), 11)
+	full := NewTestChain(core.NewBlockChain(memorydb.New()), 10)
+	for i := 0; i < 5; i++ {
+		other.MineBlock(false)
+		full.MineBlock(false)
+	}
+	db := memorydb.New()
+	for _, bc := range []*core.BlockChain{other.Blockchain, full.Blockchain} {
+		client, server := newPipe()
+		defer client.Close()
+		go serve(server, bc, nil)
+		status := &StatusData{ProtocolVersion: ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+		if _, err := Handshake(client, status); err != nil {
+			t.Fatalf("handshake failed: %v", err)
+		}
+		if bc == other.Blockchain {
+			if err := SyncState(client, db, bc.CurrentHeader()); err != nil {
+				t.Fatalf("failed to sync state: %v", err)
+			}
+			continue
+		}
+
+		light := core.NewIoTBlockChain(db, other.Blockchain.CurrentBlock())
+		if err := SyncDelta(client, light); err != ErrNoDelta {
+			t.Fatalf("delta from orphaned head, err %v", err)
+		}
+		if err := SyncProof(client, light); err != nil {
+			t.Fatalf("failed to sync proof: %v", err)
+		}
+		if light.CurrentBlock().Hash() != bc.CurrentBlock().Hash() || light.StateRoot() != bc.StateRoot() {
+			t.Fatal("light node is not synchronized to full node's current block")
+		}
+		if count := rawdb.CountStates(db); count != 10 {
+			t.Fatalf("%d states are left (expected 10)", count)
+		}
+
+		// genesis has no epoch headers before it
+		if err := SyncEpochHeaders(client, db, bc.Genesis().Header()); err != nil {
+			t.Fatalf("failed to sync epoch headers of genesis: %v", err)
+		}
+	}
+}
+
+func TestSyncAccounts(t *testing.T) {
+	full := NewTestChain(core.NewBlockChain(memorydb.New()), 10)
+	for i := 0; i < 15; i++ {
+		full.MineBlock(false)
+	}
+	bc := full.Blockchain
+	client, server := newPipe()
+	defer client.Close()
+	go serve(server, bc, nil)
+
+	status := &StatusData{ProtocolVersion: ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+	if _, err := Handshake(client, status); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+
+	// watch two users and an unknown address
+	head := bc.CurrentBlock()
+	watched := []common.Address{
+		crypto.PubkeyToAddress(&full.privkeys[0].PublicKey),
+		crypto.PubkeyToAddress(&full.privkeys[1].PublicKey),
+		common.BytesToAddress([]byte{1}),
+	}
+	db := memorydb.New()
+	states, err := SyncAccounts(client, db, head.Header(), watched)
+	if err != nil {
+		t.Fatalf("failed to sync accounts: %v", err)
+	}
+	for i, address := range watched[:2] {
+		if states[address] != rawdb.ReadState(bc.GetDB(), &full.privkeys[i].PublicKey) {
+			t.Fatalf("wrong state of watched address %d", i)
+		}
+		if tx, _, _, _ := rawdb.ReadTransaction(db, states[address]); tx == nil {
+			t.Fatalf("tx of watched address %d is not written", i)
+		}
+	}
+	if states[watched[2]] != (common.Hash{}) {
+		t.Fatal("unknown address has state")
+	}
+
+	// forged state is rejected
+	var data AccountsData
+	req := &GetAccountsData{HeadHash: head.Hash(), HeadNumber: head.Number(), Addresses: watched[:1]}
+	if err := Request(client, GetAccountsMsg, req, AccountsMsg, &data); err != nil {
+		t.Fatal(err)
+	}
+	data.Accounts[0].TxHash = common.Hash{}
+	if err := verifyAccount(head.Header(), &data.Accounts[0]); err != state.ErrInvalidStateProof {
+		t.Fatalf("forged state is accepted, err %v", err)
+	}
+
+	// watched light node follows next blocks without whole state
+	for address, txHash := range states {
+		if txHash != (common.Hash{}) {
+			rawdb.WriteState(db, address, txHash)
+		}
+	}
+	if err := SyncEpochHeaders(client, db, head.Header()); err != nil {
+		t.Fatalf("failed to sync epoch headers: %v", err)
+	}
+	light := core.NewWatchedIoTBlockChain(db, head, watched)
+	for i := 0; i < 5; i++ {
+		if block := full.MineBlock(false); block != nil {
+			if err := light.Insert(block); err != nil {
+				t.Fatalf("failed to insert block %d: %v", block.Number(), err)
+			}
+		}
+	}
+	for i := range watched[:2] {
+		if rawdb.ReadState(db, &full.privkeys[i].PublicKey) != rawdb.ReadState(bc.GetDB(), &full.privkeys[i].PublicKey) {
+			t.Fatalf("watched address %d is not updated", i)
+		}
+	}
+	if rawdb.CountStates(db) > len(watched) {
+		t.Fatal("light node keeps states which are not watched")
+	}
+}
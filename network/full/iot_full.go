@@ -1,27 +1,35 @@
 /*
   IoT-full Node : Send only interlink blocks from chain and keep update
+                  (keep mining, push new blocks to light nodes, and gossip txs and blocks with full nodes)
 */
 
 package main
 
 import (
-	"io"
+	"crypto/tls"
 	"log"
-	"net"
 	"os"
 	"sync"
+	"time"
 	"encoding/json"
 	"path/filepath"
 
-	"github.com/altair-lab/xoreum/xordb"
+	"github.com/altair-lab/xoreum/consensus/pow"
 	"github.com/altair-lab/xoreum/core"
 	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
 	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/network/p2p"
+	"github.com/altair-lab/xoreum/network/rpc"
 	"github.com/altair-lab/xoreum/xordb/leveldb"
 )
 
 var Blockchain *core.BlockChain
 var mutex = &sync.Mutex{}
+var broadcaster = network.NewBroadcaster()
+var server *p2p.Server
+var gossip *p2p.Gossip
 
 type Configuration struct {
 	Hostname	string
@@ -30,6 +38,11 @@ type Configuration struct {
 	Participants	int64
 	PrintMode	bool
 	MiningInterval	int
+	Bootnodes	[]string // "host:port" of full nodes to connect first
+	MaxPeers	int      // maximum number of peers (full and light nodes)
+	Secure		bool     // secure connections with node key (TLS)
+	NodeKey		string   // file of node key (default: nodekey)
+	RPCAddr		string   // "host:port" which JSON-RPC server listens on (default: disabled)
 }
 
 func main() {
@@ -54,11 +67,17 @@ func main() {
 	last_BN := rawdb.ReadHeaderNumber(db, last_hash)
 
 	// When there is no existing DB
+	var testChain *network.TestChain
 	if last_BN == nil {
 		// Initialize chain and store to DB
 		log.Println("Initialize Chain")
 		// Mining and Print Blocks
-		Blockchain = network.MakeTestBlockChain(configuration.BlockNumber, configuration.Participants, configuration.MiningInterval, configuration.PrintMode, db)
+		testChain = network.NewTestChain(core.NewBlockChain(db), configuration.Participants)
+		for i := int64(1); i <= configuration.BlockNumber; i++ {
+			time.Sleep(time.Duration(configuration.MiningInterval) * time.Second)
+			testChain.MineBlock(configuration.PrintMode)
+		}
+		Blockchain = testChain.Blockchain
 		log.Println("Done")
 	} else {
 		// Load blocks from 1st block (0 = genesis)
@@ -69,60 +88,125 @@ func main() {
 			Blockchain.PrintBlockChain()
 			//rawdb.ReadStates(db)
 		}
+		// test users keep their states in loaded chain
+		testChain = network.NewTestChain(Blockchain, configuration.Participants)
 		log.Println("Done")
 	}
 
+	// Load node key which light nodes can pin
+	var tlsConfig *tls.Config
+	if configuration.Secure {
+		if configuration.NodeKey == "" {
+			configuration.NodeKey = "nodekey"
+		}
+		key, err := network.LoadNodeKey(configuration.NodeKey)
+		if err != nil {
+			log.Fatal("failed to load node key: ", err)
+		}
+		tlsConfig, err = network.TLSConfig(key, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("node key: %v", crypto.PubkeyToAddress(&key.PublicKey).ToHex())
+	}
 
-	// start TCP and serve TCP server
-	server, err := net.Listen("tcp", configuration.Hostname+":"+configuration.Port)
+	// Serve light nodes, and connect with full nodes (bootnodes and discovered ones)
+	server = p2p.NewServer(p2p.Config{
+		ListenAddr: configuration.Hostname + ":" + configuration.Port,
+		Bootnodes:  configuration.Bootnodes,
+		MaxPeers:   configuration.MaxPeers,
+		TLS:        tlsConfig,
+		Status: func() *network.StatusData {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return network.NewStatus(Blockchain)
+		},
+		Handler: handleMsg,
+		Disconnected: func(p *p2p.Peer) {
+			broadcaster.Unsubscribe(p.Conn)
+			gossip.RemovePeer(p)
+		},
+	})
+	gossip = p2p.NewGossip(server, Blockchain, testChain.Txpool, mutex)
+
+	// Push new heads (mined or received from peers) to subscribed light nodes
+	heads := make(chan core.ChainHeadEvent, 64)
+	Blockchain.SubscribeChainHeadEvent(heads)
+	go pushNewHeads(heads)
+	err = server.Start()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer server.Close()
 
-	// Create a new connection each time we receive a connection request
-	for {
-		conn, err := server.Accept()
-		if err != nil {
+	// Serve JSON-RPC requests (txs sent by clients are announced to peers)
+	if configuration.RPCAddr != "" {
+		rpcServer := rpc.NewServer(Blockchain, testChain.Txpool, mutex)
+		rpcServer.Sent = func(tx *types.Transaction) {
+			gossip.AnnounceTxs(types.Transactions{tx})
+		}
+		if err := rpcServer.Start(configuration.RPCAddr); err != nil {
 			log.Fatal(err)
 		}
-		go handleConn(conn, db)
+		log.Printf("rpc server listens on %v", rpcServer.Addr())
 	}
+
+	// Keep mining every interval, and push new blocks to peers
+	keepMining(testChain, configuration)
 }
 
-// connection
-func handleConn(conn net.Conn, db xordb.Database) {
-	addr := conn.RemoteAddr().String()
-	recvBuf := make([]byte, 4096) // receive buffer: 4kb
-
-	// Connected to new client
-	log.Printf("CONNECTED TO %v\n", addr)
-
-	// Remove GetAccounts
-	network.SendState(conn, db)
-
-	// Send only Interlink block data
-	interlinks := Blockchain.CurrentBlock().GetUniqueInterlink()
-	network.SendInterlinks(conn, interlinks, Blockchain)
-	quit := make(chan bool)
-
-	// Check recvBuf every clock
-	go func() {
-		for {
-			// Get input data from clients every clock
-			_, err := conn.Read(recvBuf)
-
-			if nil != err {
-				if io.EOF == err {
-					log.Printf("Connection is closed from client; %v", conn.RemoteAddr().String())
-					quit <- true
-					return
-				}
-				log.Printf("fail to receive data; err: %v", err)
-				quit <- true
-				return
-			}
+// keepMining makes random txs and mines a block every MiningInterval,
+// and announces them. lock is held only while txpool and blockchain are
+// accessed (not while PoW)
+func keepMining(testChain *network.TestChain, configuration Configuration) {
+	for {
+		time.Sleep(time.Duration(configuration.MiningInterval) * time.Second)
+
+		mutex.Lock()
+		txs := testChain.AddTestTxs()
+		header, blockTxs := testChain.Miner.Prepare(testChain.Txpool)
+		mutex.Unlock()
+		gossip.AnnounceTxs(txs)
+		if header == nil {
+			log.Println("Mining Fail")
+			continue
+		}
+
+		pow.Seal(header)
+		block := types.NewBlock(header, blockTxs)
+		if (configuration.PrintMode) {
+			block.PrintBlock()
 		}
 
-	}()
+		// chain may be changed while PoW (then block is inserted as side block)
+		mutex.Lock()
+		err := Blockchain.Insert(block)
+		mutex.Unlock()
+		if err != nil {
+			log.Printf("failed to insert mined block; err: %v", err)
+			continue
+		}
+		gossip.AnnounceBlock(block)
+	}
+}
+
+// pushNewHeads pushes new heads of canonical chain to subscribed light nodes
+func pushNewHeads(heads <-chan core.ChainHeadEvent) {
+	for event := range heads {
+		block := event.Block
+		broadcaster.Broadcast(block, Blockchain.GetTd(block.Hash(), block.Number()))
+	}
+}
+
+// handleMsg serves peer's request (proof, state, interlink blocks, ...)
+// and gossip of full node peers
+func handleMsg(p *p2p.Peer, msg network.Msg) error {
+	if handled, err := gossip.HandleMsg(p, msg); handled {
+		return err
+	}
+	if msg.Code == network.SubscribeMsg {
+		// light node may be idle while waiting for new blocks
+		p.SetReadTimeout(0)
+		return broadcaster.Subscribe(p.Conn, Blockchain)
+	}
+	return network.HandleMsgLocked(p.Conn, Blockchain, msg, mutex)
 }
@@ -1,25 +1,50 @@
 /*
   Light Node : Get all blocks from chain and insert
   IoT Node   : Get interlink blocks from chain and validate => Set Genesis block = Currnt block
+               Keep following new blocks from full node (reconnect when connection is lost)
 */
 
 package main
 
 import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"log"
-	"net"
 	"os"
+	"strings"
 	"encoding/json"
+	"io/ioutil"
+	"math/big"
 	"path/filepath"
+	"time"
 
+	"github.com/altair-lab/xoreum/common"
 	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/nipopow"
 	"github.com/altair-lab/xoreum/core/rawdb"
 	"github.com/altair-lab/xoreum/core/types"
 	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/xordb"
 	"github.com/altair-lab/xoreum/xordb/leveldb"
 )
 
 var Blockchain *core.BlockChain
+var tlsConfig *tls.Config // nil: plaintext connections
+
+const (
+	// FollowTimeout is how long light node waits for new block before reconnecting
+	FollowTimeout = 5 * time.Minute
+
+	// delay before reconnecting is doubled from MinReconnectDelay to MaxReconnectDelay
+	MinReconnectDelay = 1 * time.Second
+	MaxReconnectDelay = 1 * time.Minute
+
+	// MaxFullNodes is the maximum number of full nodes whose chains are compared
+	// (configured full nodes and ones discovered from them)
+	MaxFullNodes = 16
+)
 
 type Configuration struct {
 	Hostname	string
@@ -28,6 +53,11 @@ type Configuration struct {
 	Participants	int64
 	PrintMode	bool
 	MiningInterval	int
+	FullNodes	[]string // "host:port" of full nodes to discover others from (default: Hostname:Port)
+	WatchAddresses	[]string // hex addresses whose states light node keeps (default: all)
+	Secure		bool     // secure connections with full nodes (TLS)
+	PinnedKeys	[]string // hex addresses of full nodes' keys which light node trusts (default: any)
+	ReportFile	string   // file which costs of synchronization are written into (default: sync-report.json)
 }
 
 func main() {
@@ -45,69 +75,84 @@ func main() {
 	if err != nil {
 		log.Println("error : ", err)
 	}
+	if configuration.ReportFile == "" {
+		configuration.ReportFile = "sync-report.json"
+	}
 
 	// Load DB
 	db, _ := leveldb.New("chaindata-iot", 0, 0, "")
 	last_hash := rawdb.ReadLastHeaderHash(db)
 	last_BN := rawdb.ReadHeaderNumber(db, last_hash)
 
-	// When there is no existing DB
-	if last_BN == nil {
-		// Connect with full node (server)
-		conn, err := net.Dial("tcp", configuration.Hostname+":"+configuration.Port)
-		if nil != err {
-			log.Fatal("failed to connect to server")
+	// Addresses which light node watches (nil: keep all states)
+	var watched []common.Address
+	for _, address := range configuration.WatchAddresses {
+		b, err := hex.DecodeString(strings.TrimPrefix(address, "0x"))
+		if err != nil || len(b) != common.AddressLength {
+			log.Fatal("invalid watch address: ", address)
 		}
+		watched = append(watched, common.BytesToAddress(b))
+	}
 
-		log.Println("Conntected!")
-
-		// Receive State
-		err = network.RecvState(conn, db)
-		if nil != err {
-			log.Fatal("failed to receive state")
+	// Full nodes' keys which light node trusts
+	if configuration.Secure {
+		var pinned []common.Address
+		for _, key := range configuration.PinnedKeys {
+			b, err := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+			if err != nil || len(b) != common.AddressLength {
+				log.Fatal("invalid pinned key: ", key)
+			}
+			pinned = append(pinned, common.BytesToAddress(b))
 		}
-		log.Println("Receive state done!")
-
-		// Get interlinks length
-		interlinkslen, err := network.RecvLength(conn)
-		if nil != err {
+		tlsConfig, err = network.TLSConfig(nil, pinned)
+		if err != nil {
 			log.Fatal(err)
 		}
-		currentBlock := &types.Block{}
-
-		log.Println("Receive Interlink Blocks . . .")
-		for i := uint32(0); i < interlinkslen; i++ {
-			// Receive interlink block
-			block, err := network.RecvBlock(conn)
-			if err != nil {
-				return
-			}
+	}
 
-			// Block validation (sign, nonce, total balance)
-			err = block.ValidateBlock()
-			if err != nil {
-				log.Fatal(err)
-				return
+	// When there is no existing DB
+	var conn *network.Conn
+	if last_BN == nil {
+		// Connect with full node (server) which has the best chain, and receive
+		// everything at its proof's tip (retry when full node's chain is changed)
+		delay := MinReconnectDelay
+		for {
+			var proof *nipopow.Proof
+			conn, proof, err = connectBestFullNode(configuration, nil)
+			if nil == err {
+				log.Println("Conntected!")
+				Blockchain, err = syncToProof(conn, db, proof, watched, configuration.PrintMode)
+				if nil == err {
+					break
+				}
+				conn.Close()
 			}
-			currentBlock = block
+			log.Printf("failed to synchronize; err: %v", err)
 
-			// Print received blocks
-			if (configuration.PrintMode) {
-				block.PrintBlock()
+			time.Sleep(delay)
+			if delay *= 2; delay > MaxReconnectDelay {
+				delay = MaxReconnectDelay
 			}
 		}
-
-		// Make IoT blockchain with current block (= genesis block)
-		Blockchain = core.NewIoTBlockChain(db, currentBlock)
-		rawdb.WriteLastHeaderHash(db, currentBlock.GetHeader().Hash())
+		rawdb.WriteLastHeaderHash(db, Blockchain.CurrentBlock().Hash())
 		log.Println("Synchronization Done!")
 	} else {
 		// Load blocks after genesis block
 		genesis_hash := rawdb.ReadGenesisHeaderHash(db)
 		genesis_BN := rawdb.ReadHeaderNumber(db, genesis_hash)
 		genesis := rawdb.LoadBlockByBN(db, *genesis_BN)
-		Blockchain = core.NewIoTBlockChain(db, genesis)
+		if watched != nil {
+			Blockchain = core.NewWatchedIoTBlockChain(db, genesis, watched)
+		} else {
+			Blockchain = core.NewIoTBlockChain(db, genesis)
+		}
 		log.Println("Load Block Done!")
+
+		// Resume synchronization from loaded head (delta is received below)
+		conn, _, err = connectBestFullNode(configuration, Blockchain)
+		if nil != err {
+			log.Println(err)
+		}
 	}
 
 	// Print blockchain
@@ -116,5 +161,234 @@ func main() {
 		//rawdb.ReadStates(db)
 	}
 
-	// [TODO] Keep mining every interval
+	// Keep following new blocks, and reconnect with backoff when connection is lost
+	delay := MinReconnectDelay
+	reported := false
+	for {
+		if conn != nil {
+			// Catch up with interlink delta and changed states (not all blocks after head)
+			err = network.SyncDelta(conn, Blockchain)
+			if err == network.ErrNoDelta {
+				// head is orphaned (or too old), so synchronize with full node's proof again
+				log.Printf("no delta from block %d, synchronize with proof", Blockchain.CurrentBlock().Number())
+				err = network.SyncProof(conn, Blockchain)
+			}
+
+			followed := false
+			if err == nil {
+				log.Printf("synchronized to block %d", Blockchain.CurrentBlock().Number())
+				if !reported {
+					reported = true
+					if err := writeReport(configuration.ReportFile, Blockchain.CurrentBlock()); err != nil {
+						log.Println("failed to write sync report: ", err)
+					}
+				}
+				conn.SetReadTimeout(FollowTimeout)
+				err = network.Follow(conn, Blockchain, func(block *types.Block) {
+					followed = true
+					log.Printf("new block %d (%d txs)", block.Number(), len(block.Transactions()))
+					if (configuration.PrintMode) {
+						block.PrintBlock()
+					}
+				})
+			}
+			conn.Close()
+			log.Printf("stop following %v; err: %v", conn.RemoteAddr(), err)
+			if followed {
+				delay = MinReconnectDelay
+			}
+		}
+
+		time.Sleep(delay)
+		if delay *= 2; delay > MaxReconnectDelay {
+			delay = MaxReconnectDelay
+		}
+		conn, _, err = connectBestFullNode(configuration, Blockchain)
+		if nil != err {
+			log.Println(err)
+		}
+	}
+}
+
+// syncToProof receives interlink blocks, state and epoch headers at the tip of
+// proof from full node, and makes IoT blockchain whose genesis block is the tip.
+// every request is pinned to the tip, so full node's new blocks do not matter
+// (error is returned if the tip is not in full node's canonical chain anymore).
+func syncToProof(conn *network.Conn, db xordb.Database, proof *nipopow.Proof, watched []common.Address, printMode bool) (*core.BlockChain, error) {
+	tip := proof.Tip()
+
+	// Receive interlink blocks (from genesis to the tip)
+	log.Println("Receive Interlink Blocks . . .")
+	stop := network.Measure(network.PhaseInterlink)
+	var blocks []*types.Block
+	err := network.Request(conn, network.GetInterlinksMsg, &network.GetInterlinksData{HeadHash: tip.Hash()}, network.BlocksMsg, &blocks)
+	if nil == err {
+		// Interlink chain validation (genesis, sign, nonce, interlink and levels)
+		err = nipopow.VerifyInterlinkChain(blocks, params.MainnetGenesisHash)
+	}
+	stop()
+	if nil != err {
+		return nil, err
+	}
+
+	// Print received blocks
+	if (printMode) {
+		for _, block := range blocks {
+			block.PrintBlock()
+		}
+	}
+
+	// Received blocks should end with proven chain's tip
+	currentBlock := blocks[len(blocks)-1]
+	if currentBlock.GetHeader().Hash() != tip.Hash() {
+		return nil, network.ErrProofMismatch
+	}
+
+	// Receive state (all states, or watched accounts' with proofs against state root)
+	if watched == nil {
+		if err := network.SyncState(conn, db, currentBlock.GetHeader()); nil != err {
+			return nil, err
+		}
+		log.Println("Receive state done!")
+	} else {
+		states, err := network.SyncAccounts(conn, db, currentBlock.GetHeader(), watched)
+		if nil != err {
+			return nil, err
+		}
+		for address, txHash := range states {
+			if txHash != (common.Hash{}) {
+				rawdb.WriteState(db, address, txHash)
+			}
+		}
+		log.Printf("Receive %d watched accounts done!", len(states))
+	}
+
+	// Receive headers of current block's difficulty epoch (to check following blocks)
+	if err := network.SyncEpochHeaders(conn, db, currentBlock.GetHeader()); nil != err {
+		return nil, err
+	}
+
+	// Make IoT blockchain with current block (= genesis block)
+	if watched != nil {
+		return core.NewWatchedIoTBlockChain(db, currentBlock, watched), nil
+	}
+	bc := core.NewIoTBlockChain(db, currentBlock)
+
+	// Received state should match with current block's state root
+	if bc.StateRoot() != currentBlock.GetHeader().Root {
+		return nil, errors.New("received state does not match with state root")
+	}
+	return bc, nil
+}
+
+// connectBestFullNode connects to all full nodes (including their peers), and keeps
+// connection with the one whose nipopow proof is valid and the best (bc is nil before sync)
+func connectBestFullNode(configuration Configuration, bc *core.BlockChain) (*network.Conn, *nipopow.Proof, error) {
+	addrs := append([]string{}, configuration.FullNodes...)
+	if len(addrs) == 0 {
+		addrs = []string{configuration.Hostname + ":" + configuration.Port}
+	}
+	known := make(map[string]bool)
+	for _, addr := range addrs {
+		known[addr] = true
+	}
+
+	// light node does not know total difficulty of its chain
+	status := &network.StatusData{
+		ProtocolVersion: network.ProtocolVersion,
+		GenesisHash:     params.MainnetGenesisHash,
+		HeadHash:        params.MainnetGenesisHash,
+		TD:              new(big.Int),
+	}
+	if bc != nil {
+		status.HeadHash = bc.CurrentBlock().Hash()
+		status.HeadNumber = bc.CurrentBlock().Number()
+	}
+
+	var bestConn *network.Conn
+	var bestProof *nipopow.Proof
+	for i := 0; i < len(addrs); i++ {
+		addr := addrs[i]
+		var conn *network.Conn
+		var err error
+		if tlsConfig != nil {
+			conn, err = network.DialSecure(addr, tlsConfig)
+		} else {
+			conn, err = network.Dial(addr)
+		}
+		if nil != err {
+			log.Printf("failed to connect to %v; err: %v", addr, err)
+			continue
+		}
+
+		// Exchange status, and skip incompatible full node
+		if _, err := network.Handshake(conn, status); err != nil {
+			log.Printf("handshake failed with %v; err: %v", addr, err)
+			conn.Close()
+			continue
+		}
+
+		// Discover full nodes which are connected to it
+		var peers []string
+		err = network.Request(conn, network.GetPeersMsg, &network.GetPeersData{}, network.PeersMsg, &peers)
+		if err != nil {
+			log.Printf("failed to get peers from %v; err: %v", addr, err)
+		}
+		for _, peer := range peers {
+			if !known[peer] && len(addrs) < MaxFullNodes {
+				known[peer] = true
+				addrs = append(addrs, peer)
+			}
+		}
+
+		stop := network.Measure(network.PhaseProof)
+		proof := new(nipopow.Proof)
+		req := &network.GetProofData{M: params.NipopowM, K: params.NipopowK}
+		err = network.Request(conn, network.GetProofMsg, req, network.ProofMsg, proof)
+		if err == nil {
+			err = proof.Verify(params.MainnetGenesisHash, params.NipopowK)
+		}
+		stop()
+		if err != nil {
+			log.Printf("invalid proof from %v; err: %v", addr, err)
+			conn.Close()
+			continue
+		}
+
+		if bestProof == nil || nipopow.Compare(proof, bestProof, params.NipopowM) > 0 {
+			if bestConn != nil {
+				bestConn.Close()
+			}
+			bestConn, bestProof = conn, proof
+		} else {
+			conn.Close()
+		}
+	}
+
+	if bestConn == nil {
+		return nil, nil, errors.New("failed to connect to server")
+	}
+	log.Printf("best chain from %v (number %d)", bestConn.RemoteAddr(), bestProof.Tip().Number)
+	return bestConn, bestProof, nil
+}
+
+// writeReport writes costs (bytes, messages and time) of synchronization
+// phases into file as JSON, with the head which light node is synchronized to
+func writeReport(file string, head *types.Block) error {
+	report := struct {
+		Head   uint64 // head block number (chain length)
+		Phases map[string]network.PhaseCost
+	}{
+		Head:   head.Number(),
+		Phases: network.SyncCosts(),
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		return err
+	}
+	log.Printf("sync report is written into %v", file)
+	return nil
 }
@@ -0,0 +1,149 @@
+/*
+  Node : Full node without test users (does not mine)
+         Keep chain in DB, follow new blocks and txs from full nodes, serve light nodes,
+         and serve JSON-RPC requests (dashboards and scripts)
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/network/p2p"
+	"github.com/altair-lab/xoreum/network/rpc"
+	"github.com/altair-lab/xoreum/xordb/leveldb"
+)
+
+var Blockchain *core.BlockChain
+var mutex = &sync.Mutex{}
+var broadcaster = network.NewBroadcaster()
+var gossip *p2p.Gossip
+
+type Configuration struct {
+	Hostname  string
+	Port      string
+	Bootnodes []string // "host:port" of full nodes to connect first
+	MaxPeers  int      // maximum number of peers (full and light nodes)
+	Secure    bool     // secure connections with node key (TLS)
+	NodeKey   string   // file of node key (default: nodekey)
+	RPCAddr   string   // "host:port" which JSON-RPC server listens on (default: localhost:8545)
+	DataDir   string   // directory of DB (default: chaindata-node)
+}
+
+func main() {
+	// Load configuration
+	ex, err := os.Executable()
+	if err != nil {
+		log.Println(err)
+	}
+	exPath := filepath.Dir(ex)
+	file, _ := os.Open(exPath + "/conf.json")
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	configuration := Configuration{}
+	err = decoder.Decode(&configuration)
+	if err != nil {
+		log.Println("error : ", err)
+	}
+	if configuration.RPCAddr == "" {
+		configuration.RPCAddr = "localhost:8545"
+	}
+	if configuration.DataDir == "" {
+		configuration.DataDir = "chaindata-node"
+	}
+
+	// Load chain from DB (or start from genesis block)
+	db, err := leveldb.New(configuration.DataDir, 0, 0, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	Blockchain = core.NewBlockChain(db)
+	txpool := core.NewTxPool(Blockchain)
+	log.Printf("Load Chain Done! (block %d)", Blockchain.CurrentBlock().Number())
+
+	// Load node key which light nodes can pin
+	var tlsConfig *tls.Config
+	if configuration.Secure {
+		if configuration.NodeKey == "" {
+			configuration.NodeKey = "nodekey"
+		}
+		key, err := network.LoadNodeKey(configuration.NodeKey)
+		if err != nil {
+			log.Fatal("failed to load node key: ", err)
+		}
+		tlsConfig, err = network.TLSConfig(key, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("node key: %v", crypto.PubkeyToAddress(&key.PublicKey).ToHex())
+	}
+
+	// Serve light nodes, and gossip with full nodes (bootnodes and discovered ones)
+	server := p2p.NewServer(p2p.Config{
+		ListenAddr: configuration.Hostname + ":" + configuration.Port,
+		Bootnodes:  configuration.Bootnodes,
+		MaxPeers:   configuration.MaxPeers,
+		TLS:        tlsConfig,
+		Status: func() *network.StatusData {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return network.NewStatus(Blockchain)
+		},
+		Handler: handleMsg,
+		Disconnected: func(p *p2p.Peer) {
+			broadcaster.Unsubscribe(p.Conn)
+			gossip.RemovePeer(p)
+		},
+	})
+	gossip = p2p.NewGossip(server, Blockchain, txpool, mutex)
+
+	// Push new heads (received from peers) to subscribed light nodes
+	heads := make(chan core.ChainHeadEvent, 64)
+	Blockchain.SubscribeChainHeadEvent(heads)
+	go pushNewHeads(heads)
+	if err := server.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Serve JSON-RPC requests (txs sent by clients are announced to peers)
+	rpcServer := rpc.NewServer(Blockchain, txpool, mutex)
+	rpcServer.Sent = func(tx *types.Transaction) {
+		gossip.AnnounceTxs(types.Transactions{tx})
+	}
+	if err := rpcServer.Start(configuration.RPCAddr); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("rpc server listens on %v", rpcServer.Addr())
+
+	select {}
+}
+
+// pushNewHeads pushes new heads of canonical chain to subscribed light nodes
+func pushNewHeads(heads <-chan core.ChainHeadEvent) {
+	for event := range heads {
+		block := event.Block
+		broadcaster.Broadcast(block, Blockchain.GetTd(block.Hash(), block.Number()))
+	}
+}
+
+// handleMsg serves peer's request and gossip of full node peers
+func handleMsg(p *p2p.Peer, msg network.Msg) error {
+	if handled, err := gossip.HandleMsg(p, msg); handled {
+		return err
+	}
+	if msg.Code == network.SubscribeMsg {
+		// light node may be idle while waiting for new blocks
+		p.SetReadTimeout(0)
+		return broadcaster.Subscribe(p.Conn, Blockchain)
+	}
+	return network.HandleMsgLocked(p.Conn, Blockchain, msg, mutex)
+}
@@ -0,0 +1,459 @@
+package p2p
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus"
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/network"
+)
+
+const (
+	MaxSeenHashes  = 32 * 1024 // txs and blocks which node remembers as seen
+	MaxKnownHashes = 4 * 1024  // txs and blocks which node remembers per peer
+	MaxOrphans     = 1024      // received blocks whose ancestors are being fetched
+	FetchBatch     = 64        // maximum number of ancestors requested at once
+
+	// penalties of invalid txs and blocks (see Server.Penalize)
+	InvalidTxPenalty    = 20
+	InvalidBlockPenalty = 50
+)
+
+var ErrTooManyItems = errors.New("too many items in gossip message")
+
+// invalidBlockErrors are errors of blocks which fail verification by
+// themselves. other errors (e.g. future block, unknown parent or state
+// conflict) can be hit by honest peers in races or reorgs.
+var invalidBlockErrors = map[error]bool{
+	consensus.ErrInvalidNumber:     true,
+	consensus.ErrInvalidTimestamp:  true,
+	consensus.ErrInvalidVersion:    true,
+	consensus.ErrInvalidDifficulty: true,
+	consensus.ErrInvalidInterlink:  true,
+	consensus.ErrInvalidPoW:        true,
+	core.ErrWrongBlockNumber:       true,
+	core.ErrWrongTxRoot:            true,
+	types.ErrUnknownTxVersion:      true,
+	types.ErrDiffFieldLength:       true,
+	types.ErrNoFields:              true,
+	types.ErrDuplicateParticipant:  true,
+	types.ErrInvalidPostStates:     true,
+	types.ErrInvalidSig:            true,
+}
+
+// Gossip relays txs and blocks between full node peers. new txs and blocks
+// are announced by hash, and peers fetch unknown ones from the announcer.
+// block whose parent is unknown is kept as orphan until its ancestors are fetched.
+// blockchain and txpool are accessed with lock held, which node holds while it
+// uses them (e.g. miner), and messages are sent without lock.
+type Gossip struct {
+	srv  *Server
+	bc   *core.BlockChain
+	pool *core.TxPool
+	lock sync.Locker
+
+	// Inserted is called after a received block is inserted (optional)
+	Inserted func(block *types.Block)
+
+	mu      sync.Mutex
+	seen    *hashCache             // txs and blocks which this node has seen
+	known   map[*Peer]*hashCache   // txs and blocks which each peer has
+	orphans map[common.Hash]orphan // received blocks whose parents are unknown
+}
+
+type orphan struct {
+	block *types.Block
+	peer  *Peer // peer which sent the block
+}
+
+func NewGossip(srv *Server, bc *core.BlockChain, pool *core.TxPool, lock sync.Locker) *Gossip {
+	return &Gossip{
+		srv:     srv,
+		bc:      bc,
+		pool:    pool,
+		lock:    lock,
+		seen:    newHashCache(MaxSeenHashes),
+		known:   make(map[*Peer]*hashCache),
+		orphans: make(map[common.Hash]orphan),
+	}
+}
+
+// HandleMsg handles gossip message from peer, and returns false if msg is not
+// a gossip message. received txs and blocks are added into txpool and blockchain
+// with lock held, so caller should not hold it.
+func (g *Gossip) HandleMsg(p *Peer, msg network.Msg) (bool, error) {
+	switch msg.Code {
+	case network.NewTxHashesMsg:
+		var hashes []common.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			return true, err
+		}
+		if len(hashes) > network.MaxTxsServe {
+			return true, ErrTooManyItems
+		}
+		g.markKnown(p, hashes...)
+		unknown := []common.Hash{}
+		g.lock.Lock()
+		for _, hash := range hashes {
+			// hash is marked as seen when tx is received (see handleTxs),
+			// so it is fetched from other announcers if this one fails
+			if !g.isSeen(hash) && g.pool.Get(hash) == nil {
+				unknown = append(unknown, hash)
+			}
+		}
+		g.lock.Unlock()
+		if len(unknown) == 0 {
+			return true, nil
+		}
+		return true, p.WriteMsg(network.GetTxsMsg, unknown)
+
+	case network.GetTxsMsg:
+		var hashes []common.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			return true, err
+		}
+		txs := []*types.Transaction{}
+		g.lock.Lock()
+		for _, hash := range hashes {
+			if len(txs) >= network.MaxTxsServe {
+				break
+			}
+			tx := g.pool.Get(hash)
+			if tx == nil {
+				tx, _, _, _ = rawdb.ReadTransaction(g.bc.GetDB(), hash)
+			}
+			if tx != nil {
+				txs = append(txs, tx)
+			}
+		}
+		g.lock.Unlock()
+		return true, p.WriteMsg(network.TxsMsg, txs)
+
+	case network.TxsMsg:
+		var txs []*types.Transaction
+		if err := msg.Decode(&txs); err != nil {
+			return true, err
+		}
+		if len(txs) > network.MaxTxsServe {
+			return true, ErrTooManyItems
+		}
+		g.handleTxs(p, txs)
+		return true, nil
+
+	case network.NewBlockHashesMsg:
+		var announces []network.BlockAnnounce
+		if err := msg.Decode(&announces); err != nil {
+			return true, err
+		}
+		if len(announces) > network.MaxBlocksServe {
+			return true, ErrTooManyItems
+		}
+		numbers := []uint64{}
+		g.lock.Lock()
+		for _, announce := range announces {
+			g.markKnown(p, announce.Hash)
+			// hash is marked as seen when block is received (see handleBlocks)
+			if !g.isSeen(announce.Hash) && !g.bc.HasBlock(announce.Hash, announce.Number) {
+				numbers = append(numbers, announce.Number)
+			}
+		}
+		g.lock.Unlock()
+		if len(numbers) == 0 {
+			return true, nil
+		}
+		return true, p.WriteMsg(network.GetBlocksMsg, &network.GetBlocksData{Numbers: numbers})
+
+	case network.BlocksMsg:
+		var blocks []*types.Block
+		if err := msg.Decode(&blocks); err != nil {
+			return true, err
+		}
+		g.handleBlocks(p, blocks)
+		return true, nil
+
+	default:
+		return false, nil
+	}
+}
+
+// AnnounceTxs announces txs to full node peers which do not have them
+func (g *Gossip) AnnounceTxs(txs types.Transactions) {
+	hashes := make([]common.Hash, 0, len(txs))
+	for _, tx := range txs {
+		g.markSeen(tx.Hash)
+		hashes = append(hashes, tx.Hash)
+	}
+	for len(hashes) > 0 {
+		n := len(hashes)
+		if n > network.MaxTxsServe {
+			n = network.MaxTxsServe
+		}
+		g.announce(network.NewTxHashesMsg, hashes[:n], func(unknown []common.Hash) interface{} { return unknown })
+		hashes = hashes[n:]
+	}
+}
+
+// AnnounceBlock announces block to full node peers which do not have it
+func (g *Gossip) AnnounceBlock(block *types.Block) {
+	g.markSeen(block.Hash())
+	g.announce(network.NewBlockHashesMsg, []common.Hash{block.Hash()}, func([]common.Hash) interface{} {
+		return []network.BlockAnnounce{{Hash: block.Hash(), Number: block.Number()}}
+	})
+}
+
+// RemovePeer forgets what peer has (called when peer is disconnected)
+func (g *Gossip) RemovePeer(p *Peer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.known, p)
+	for hash, o := range g.orphans {
+		if o.peer == p {
+			delete(g.orphans, hash)
+		}
+	}
+}
+
+// announce sends payload of hashes unknown to each full node peer
+func (g *Gossip) announce(code uint64, hashes []common.Hash, payload func(unknown []common.Hash) interface{}) {
+	for _, p := range g.srv.Peers() {
+		if p.ListenAddr() == "" {
+			continue
+		}
+		unknown := []common.Hash{}
+		g.mu.Lock()
+		known := g.knownBy(p)
+		for _, hash := range hashes {
+			if known.Add(hash) {
+				unknown = append(unknown, hash)
+			}
+		}
+		g.mu.Unlock()
+		if len(unknown) == 0 {
+			continue
+		}
+		if err := p.WriteMsg(code, payload(unknown)); err != nil {
+			log.Printf("failed to announce to %v; err: %v", p.RemoteAddr(), err)
+			p.Close()
+		}
+	}
+}
+
+// handleTxs adds received txs into txpool, and relays txs which become pending
+// (future txs are relayed when they are promoted)
+func (g *Gossip) handleTxs(p *Peer, txs []*types.Transaction) {
+	added := types.Transactions{}
+	for _, tx := range txs {
+		g.markKnown(p, tx.Hash)
+		g.markSeen(tx.Hash)
+		g.lock.Lock()
+		known := g.pool.Get(tx.Hash) != nil
+		g.lock.Unlock()
+		if known {
+			continue
+		}
+		if err := tx.ValidateTx(); err != nil {
+			p.Penalize(InvalidTxPenalty)
+			continue
+		}
+		g.lock.Lock()
+		promoted, err := g.pool.AddRemote(tx)
+		g.lock.Unlock()
+		if err != nil {
+			// tx may conflict with recent blocks, which is not peer's fault
+			if err == core.ErrInvalidSender {
+				p.Penalize(InvalidTxPenalty)
+			}
+			continue
+		}
+		added = append(added, promoted...)
+	}
+	if len(added) > 0 {
+		g.AnnounceTxs(added)
+	}
+}
+
+// handleBlocks inserts received blocks (or keeps them as orphans), and
+// requests ancestors of orphans if any block is new
+func (g *Gossip) handleBlocks(p *Peer, blocks []*types.Block) {
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Number() < blocks[j].Number() })
+	progress := false
+	for _, block := range blocks {
+		g.markKnown(p, block.Hash())
+		g.markSeen(block.Hash())
+		if block.Number() == 0 || g.isOrphan(block.Hash()) {
+			continue
+		}
+		g.lock.Lock()
+		known := g.bc.HasBlock(block.Hash(), block.Number())
+		parent := g.bc.GetHeader(block.GetHeader().ParentHash, block.Number()-1)
+		g.lock.Unlock()
+		if known {
+			continue
+		}
+		progress = true
+		if parent == nil {
+			g.addOrphan(block, p)
+			continue
+		}
+		g.insert(block, p)
+	}
+	if progress {
+		g.fetchAncestors(p)
+	}
+}
+
+// insert inserts block and its orphan descendants, and relays them
+func (g *Gossip) insert(block *types.Block, p *Peer) {
+	g.lock.Lock()
+	err := g.bc.Insert(block)
+	g.lock.Unlock()
+	if err != nil {
+		if invalidBlockErrors[err] {
+			log.Printf("invalid block %d from %v; err: %v", block.Number(), p.RemoteAddr(), err)
+			p.Penalize(InvalidBlockPenalty)
+		}
+		return
+	}
+	if g.Inserted != nil {
+		g.Inserted(block)
+	}
+	g.AnnounceBlock(block)
+
+	g.mu.Lock()
+	children := []orphan{}
+	for hash, o := range g.orphans {
+		if o.block.GetHeader().ParentHash == block.Hash() {
+			children = append(children, o)
+			delete(g.orphans, hash)
+		}
+	}
+	g.mu.Unlock()
+	for _, child := range children {
+		g.insert(child.block, child.peer)
+	}
+}
+
+func (g *Gossip) isOrphan(hash common.Hash) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.orphans[hash]
+	return ok
+}
+
+func (g *Gossip) addOrphan(block *types.Block, p *Peer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.orphans) >= MaxOrphans {
+		// orphans which cannot be linked are dropped at once
+		g.orphans = make(map[common.Hash]orphan)
+	}
+	g.orphans[block.Hash()] = orphan{block: block, peer: p}
+}
+
+// fetchAncestors requests blocks before the lowest orphan from peer: blocks
+// after local head if the orphan is ahead of it, or blocks just before the
+// orphan otherwise (e.g. orphan is on a fork)
+func (g *Gossip) fetchAncestors(p *Peer) {
+	g.mu.Lock()
+	var lowest *types.Block
+	for _, o := range g.orphans {
+		if _, ok := g.orphans[o.block.GetHeader().ParentHash]; ok {
+			continue
+		}
+		if lowest == nil || o.block.Number() < lowest.Number() {
+			lowest = o.block
+		}
+	}
+	g.mu.Unlock()
+	if lowest == nil {
+		return
+	}
+
+	g.lock.Lock()
+	head := g.bc.CurrentBlock().Number()
+	g.lock.Unlock()
+	from := uint64(1)
+	if lowest.Number() > head+1 {
+		from = head + 1
+	} else if lowest.Number() > FetchBatch {
+		from = lowest.Number() - FetchBatch
+	}
+	numbers := []uint64{}
+	for number := from; number < lowest.Number() && len(numbers) < FetchBatch; number++ {
+		numbers = append(numbers, number)
+	}
+	if err := p.WriteMsg(network.GetBlocksMsg, &network.GetBlocksData{Numbers: numbers}); err != nil {
+		log.Printf("failed to request blocks from %v; err: %v", p.RemoteAddr(), err)
+	}
+}
+
+// markSeen marks hash as seen, and returns false if it is already seen
+func (g *Gossip) markSeen(hash common.Hash) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.seen.Add(hash)
+}
+
+// isSeen returns whether hash is seen (tx or block is received or announced by this node)
+func (g *Gossip) isSeen(hash common.Hash) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.seen.Has(hash)
+}
+
+func (g *Gossip) markKnown(p *Peer, hashes ...common.Hash) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	known := g.knownBy(p)
+	for _, hash := range hashes {
+		known.Add(hash)
+	}
+}
+
+func (g *Gossip) knownBy(p *Peer) *hashCache {
+	known, ok := g.known[p]
+	if !ok {
+		known = newHashCache(MaxKnownHashes)
+		g.known[p] = known
+	}
+	return known
+}
+
+// hashCache is a set of hashes which forgets the oldest one when it is full
+type hashCache struct {
+	set  map[common.Hash]struct{}
+	ring []common.Hash
+	next int // index of ring to be overwritten
+}
+
+func newHashCache(size int) *hashCache {
+	return &hashCache{set: make(map[common.Hash]struct{}), ring: make([]common.Hash, 0, size)}
+}
+
+// Has returns whether hash is in the cache
+func (c *hashCache) Has(hash common.Hash) bool {
+	_, ok := c.set[hash]
+	return ok
+}
+
+// Add adds hash, and returns false if it is already in the cache
+func (c *hashCache) Add(hash common.Hash) bool {
+	if _, ok := c.set[hash]; ok {
+		return false
+	}
+	if len(c.ring) < cap(c.ring) {
+		c.ring = append(c.ring, hash)
+	} else {
+		delete(c.set, c.ring[c.next])
+		c.ring[c.next] = hash
+		c.next = (c.next + 1) % len(c.ring)
+	}
+	c.set[hash] = struct{}{}
+	return true
+}
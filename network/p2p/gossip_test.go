@@ -0,0 +1,97 @@
+package p2p
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+// testNode is a full node which gossips with its test chain
+type testNode struct {
+	mu     sync.Mutex // lock for blockchain and txpool
+	chain  *network.TestChain
+	srv    *Server
+	gossip *Gossip
+}
+
+func startNode(t *testing.T, chain *network.TestChain, bootnodes ...string) *testNode {
+	n := &testNode{chain: chain}
+	n.srv = NewServer(Config{
+		ListenAddr: "127.0.0.1:0",
+		Bootnodes:  bootnodes,
+		Status: func() *network.StatusData {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			return network.NewStatus(chain.Blockchain)
+		},
+		Handler: func(p *Peer, msg network.Msg) error {
+			if handled, err := n.gossip.HandleMsg(p, msg); handled {
+				return err
+			}
+			return network.HandleMsgLocked(p.Conn, chain.Blockchain, msg, &n.mu)
+		},
+		Disconnected: func(p *Peer) { n.gossip.RemovePeer(p) },
+	})
+	n.gossip = NewGossip(n.srv, chain.Blockchain, chain.Txpool, &n.mu)
+	if err := n.srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestGossip(t *testing.T) {
+	a := startNode(t, network.NewTestChain(core.NewBlockChain(memorydb.New()), 6))
+	defer a.srv.Stop()
+	for i := 0; i < 5; i++ {
+		a.chain.MineBlock(false)
+	}
+
+	// b has the same test users, but no blocks
+	b := startNode(t, network.NewTestChain(core.NewBlockChain(memorydb.New()), 6), a.srv.Addr().String())
+	defer b.srv.Stop()
+	if !waitFor(func() bool { return len(a.srv.Peers()) == 1 && a.srv.Peers()[0].ListenAddr() != "" }) {
+		t.Fatal("nodes are not connected")
+	}
+
+	// b fetches announced block and its ancestors
+	a.mu.Lock()
+	block := a.chain.MineBlock(false)
+	a.mu.Unlock()
+	a.gossip.AnnounceBlock(block)
+	head := func() uint64 {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.chain.Blockchain.CurrentBlock().Number()
+	}
+	if !waitFor(func() bool { return head() == block.Number() }) {
+		t.Fatalf("block is not propagated, head %d", head())
+	}
+	if b.chain.Blockchain.CurrentBlock().Hash() != block.Hash() {
+		t.Fatal("wrong head")
+	}
+
+	// a fetches announced txs into its txpool
+	b.mu.Lock()
+	txs := b.chain.AddTestTxs()
+	for len(txs) == 0 {
+		txs = b.chain.AddTestTxs()
+	}
+	b.mu.Unlock()
+	b.gossip.AnnounceTxs(txs)
+	pending := func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for _, tx := range txs {
+			if a.chain.Txpool.Get(tx.Hash) == nil {
+				return false
+			}
+		}
+		return true
+	}
+	if !waitFor(pending) {
+		t.Fatal("txs are not propagated")
+	}
+}
@@ -0,0 +1,46 @@
+package p2p
+
+import (
+	"net"
+
+	"github.com/altair-lab/xoreum/network"
+)
+
+// Peer is a connected node which passed handshake
+type Peer struct {
+	*network.Conn
+	Status *network.StatusData // peer's status in handshake
+
+	srv        *Server
+	inbound    bool
+	listenAddr string // "host:port" which peer listens on (empty if unknown), guarded by srv.mu
+}
+
+// Inbound returns whether peer connected to this node
+func (p *Peer) Inbound() bool { return p.inbound }
+
+// ListenAddr returns "host:port" which peer listens on. it is empty if peer
+// does not listen (e.g. light node) or has not announced it yet.
+func (p *Peer) ListenAddr() string {
+	p.srv.mu.Lock()
+	defer p.srv.mu.Unlock()
+	return p.listenAddr
+}
+
+// Penalize lowers score of peer's host for misbehavior
+// (peer is disconnected and banned if its score drops to -BanScore)
+func (p *Peer) Penalize(penalty int) { p.srv.Penalize(p, penalty) }
+
+// host returns IP address of peer, which scores and bans are kept by
+func (p *Peer) host() string { return hostOf(p.RemoteAddr()) }
+
+func hostOf(addr net.Addr) string { return hostOfAddr(addr.String()) }
+
+// hostOfAddr returns host of "host:port" (addr itself if it has no port)
+func hostOfAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
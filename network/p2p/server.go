@@ -0,0 +1,606 @@
+// Package p2p manages connections between full nodes: it dials bootnodes and
+// addresses learned by peer exchange, accepts inbound peers up to the limit,
+// and bans misbehaving peers.
+package p2p
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/altair-lab/xoreum/network"
+)
+
+const (
+	DefaultMaxPeers = 50
+
+	// IdleTimeout is how long a peer may be silent
+	// (full node peers keep alive by exchanging peers every DialInterval)
+	IdleTimeout = 5 * time.Minute
+
+	// DialInterval is how often server exchanges peers and dials full nodes
+	DialInterval = 30 * time.Second
+
+	MaxPeersServe = 16   // maximum number of addresses in PeersMsg
+	MaxKnownAddrs = 1024 // maximum number of addresses to dial
+
+	// peer's host is banned for BanDuration when its score drops to -BanScore
+	BanScore    = 100
+	BanDuration = time.Hour
+
+	// score recovers by ScoreDecay every ScoreDecayInterval, so that
+	// occasional penalties of an honest host do not add up to a ban
+	ScoreDecay         = 10
+	ScoreDecayInterval = time.Minute
+
+	// MaxPendingInbound is the maximum number of inbound connections in handshake
+	// (more connections are closed before handshake)
+	MaxPendingInbound = 16
+
+	// InvalidMsgPenalty is the penalty for a message which cannot be handled
+	// (e.g. undecodable or unexpected message)
+	InvalidMsgPenalty = 50
+)
+
+var (
+	ErrTooManyPeers = errors.New("too many peers")
+
+	ErrBanned = errors.New("peer is banned")
+
+	ErrSelfConnection = errors.New("connected to itself")
+
+	ErrDuplicatePeer = errors.New("already connected to peer")
+
+	ErrServerStopped = errors.New("server is stopped")
+
+	ErrTooManyAddrs = errors.New("too many addresses in peers message")
+)
+
+// Config is the configuration of Server
+type Config struct {
+	ListenAddr  string   // "host:port" which server listens on (empty: no listening)
+	Bootnodes   []string // "host:port" of full nodes to dial first (always redialed)
+	MaxPeers    int      // maximum number of peers (default: DefaultMaxPeers)
+	MaxOutbound int      // number of full nodes which server keeps dialing (default: MaxPeers / 2)
+
+	// TLS secures connections with node keys (nil: plaintext, see network.TLSConfig)
+	TLS *tls.Config
+
+	// Status returns local status for handshake
+	Status func() *network.StatusData
+
+	// Handler handles messages except peer exchange. peer is disconnected
+	// if it returns error (and penalized unless it is a connection error).
+	Handler func(p *Peer, msg network.Msg) error
+
+	// Disconnected is called after peer is removed (optional)
+	Disconnected func(p *Peer)
+}
+
+// Server keeps connections with peers
+type Server struct {
+	config     Config
+	id         uint64 // random node ID to detect connection to itself
+	listener   net.Listener
+	listenPort uint64
+
+	mu      sync.Mutex
+	peers   map[*Peer]struct{}
+	known   map[string]bool      // addresses of full nodes to dial
+	dialing map[string]bool      // addresses being dialed
+	self    map[string]bool      // addresses which turned out to be this node
+	scores  map[string]score     // scores by host (negative for misbehavior)
+	banned  map[string]time.Time // ban expiry by host
+
+	handshaking int // inbound connections in handshake
+
+	dialReq chan struct{}
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// score is host's score, which recovers from updated (see ScoreDecay)
+type score struct {
+	value   int
+	updated time.Time
+}
+
+func NewServer(config Config) *Server {
+	if config.MaxPeers <= 0 {
+		config.MaxPeers = DefaultMaxPeers
+	}
+	if config.MaxOutbound <= 0 {
+		config.MaxOutbound = (config.MaxPeers + 1) / 2
+	}
+
+	var id [8]byte
+	rand.Read(id[:])
+	srv := &Server{
+		config:  config,
+		id:      binary.LittleEndian.Uint64(id[:]),
+		peers:   make(map[*Peer]struct{}),
+		known:   make(map[string]bool),
+		dialing: make(map[string]bool),
+		self:    make(map[string]bool),
+		scores:  make(map[string]score),
+		banned:  make(map[string]time.Time),
+		dialReq: make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+	for _, addr := range config.Bootnodes {
+		srv.known[addr] = true
+	}
+	return srv
+}
+
+// Start starts listening (if ListenAddr is set) and dialing
+func (srv *Server) Start() error {
+	if srv.config.ListenAddr != "" {
+		listener, err := net.Listen("tcp", srv.config.ListenAddr)
+		if err != nil {
+			return err
+		}
+		if srv.config.TLS != nil {
+			listener = tls.NewListener(listener, srv.config.TLS)
+		}
+		srv.listener = listener
+		srv.listenPort = uint64(listener.Addr().(*net.TCPAddr).Port)
+		srv.wg.Add(1)
+		go srv.listenLoop()
+	}
+	srv.wg.Add(1)
+	go srv.dialLoop()
+	return nil
+}
+
+// Stop disconnects all peers, and waits until they are removed
+func (srv *Server) Stop() {
+	close(srv.quit)
+	if srv.listener != nil {
+		srv.listener.Close()
+	}
+	srv.wg.Wait()
+}
+
+// Addr returns the address which server listens on (nil if not listening)
+func (srv *Server) Addr() net.Addr {
+	if srv.listener == nil {
+		return nil
+	}
+	return srv.listener.Addr()
+}
+
+// Peers returns connected peers
+func (srv *Server) Peers() []*Peer {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	peers := make([]*Peer, 0, len(srv.peers))
+	for p := range srv.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// Broadcast sends a message to all full node peers (which have listening
+// address). peer which fails to receive it is disconnected.
+func (srv *Server) Broadcast(code uint64, data interface{}) {
+	for _, p := range srv.Peers() {
+		if p.ListenAddr() == "" {
+			continue
+		}
+		if err := p.WriteMsg(code, data); err != nil {
+			log.Printf("failed to send message to %v; err: %v", p.RemoteAddr(), err)
+			p.Close()
+		}
+	}
+}
+
+// Penalize lowers score of peer's host. when the score drops to -BanScore,
+// the host is banned for BanDuration and all its peers are disconnected.
+func (srv *Server) Penalize(p *Peer, penalty int) {
+	srv.penalize(p.host(), penalty)
+}
+
+func (srv *Server) penalize(host string, penalty int) {
+	srv.mu.Lock()
+	s := srv.decayScore(host)
+	s.value -= penalty
+	if s.value > -BanScore {
+		srv.scores[host] = s
+		srv.mu.Unlock()
+		return
+	}
+	delete(srv.scores, host)
+	srv.banned[host] = time.Now().Add(BanDuration)
+	drop := []*Peer{}
+	for q := range srv.peers {
+		if q.host() == host {
+			drop = append(drop, q)
+		}
+	}
+	srv.mu.Unlock()
+
+	log.Printf("ban %v for %v", host, BanDuration)
+	for _, q := range drop {
+		q.Close()
+	}
+}
+
+// Score returns score of host (0 for a new host)
+func (srv *Server) Score(host string) int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.decayScore(host).value
+}
+
+// decayScore recovers host's score by elapsed time, and returns it. host
+// whose score recovers to 0 is forgotten. lock should be held.
+func (srv *Server) decayScore(host string) score {
+	s, ok := srv.scores[host]
+	if !ok {
+		return score{updated: time.Now()}
+	}
+	n := time.Since(s.updated) / ScoreDecayInterval
+	s.value += int(n) * ScoreDecay
+	s.updated = s.updated.Add(n * ScoreDecayInterval)
+	if s.value >= 0 {
+		delete(srv.scores, host)
+		return score{updated: time.Now()}
+	}
+	srv.scores[host] = s
+	return s
+}
+
+// decayScores recovers scores of all hosts (to forget recovered hosts)
+func (srv *Server) decayScores() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for host := range srv.scores {
+		srv.decayScore(host)
+	}
+}
+
+// Banned returns whether host is banned
+func (srv *Server) Banned(host string) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.isBanned(host)
+}
+
+func (srv *Server) isBanned(host string) bool {
+	expiry, ok := srv.banned[host]
+	if ok && time.Now().After(expiry) {
+		delete(srv.banned, host)
+		return false
+	}
+	return ok
+}
+
+func (srv *Server) listenLoop() {
+	defer srv.wg.Done()
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			select {
+			case <-srv.quit:
+				return
+			default:
+			}
+			log.Printf("failed to accept connection; err: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// reject banned host and too many pending connections before handshake
+		srv.mu.Lock()
+		reject := srv.isBanned(hostOf(conn.RemoteAddr())) || srv.handshaking >= MaxPendingInbound
+		if !reject {
+			srv.handshaking++
+		}
+		srv.mu.Unlock()
+		if reject {
+			conn.Close()
+			continue
+		}
+		srv.wg.Add(1)
+		go srv.runPeer(network.NewConn(conn), true, "")
+	}
+}
+
+// dialLoop dials full nodes until MaxOutbound peers are connected, and
+// exchanges peers with outbound peers every DialInterval
+func (srv *Server) dialLoop() {
+	defer srv.wg.Done()
+	ticker := time.NewTicker(DialInterval)
+	defer ticker.Stop()
+	for {
+		srv.dialPeers()
+		select {
+		case <-ticker.C:
+			srv.decayScores()
+			for _, p := range srv.Peers() {
+				if !p.inbound {
+					p.WriteMsg(network.GetPeersMsg, srv.getPeersData())
+				}
+			}
+		case <-srv.dialReq:
+		case <-srv.quit:
+			return
+		}
+	}
+}
+
+// requestDial wakes up dialLoop (e.g. when new addresses are known)
+func (srv *Server) requestDial() {
+	select {
+	case srv.dialReq <- struct{}{}:
+	default:
+	}
+}
+
+func (srv *Server) dialPeers() {
+	srv.mu.Lock()
+	connected := make(map[string]bool)
+	outbound := 0
+	for p := range srv.peers {
+		connected[p.listenAddr] = true
+		if !p.inbound {
+			outbound++
+		}
+	}
+	need := srv.config.MaxOutbound - outbound - len(srv.dialing)
+	if free := srv.config.MaxPeers - len(srv.peers) - len(srv.dialing); free < need {
+		need = free
+	}
+	addrs := []string{}
+	for addr := range srv.known {
+		if len(addrs) >= need {
+			break
+		}
+		if connected[addr] || srv.dialing[addr] || srv.self[addr] || srv.isBanned(hostOfAddr(addr)) {
+			continue
+		}
+		srv.dialing[addr] = true
+		addrs = append(addrs, addr)
+	}
+	srv.mu.Unlock()
+
+	for _, addr := range addrs {
+		srv.wg.Add(1)
+		go srv.dial(addr)
+	}
+}
+
+func (srv *Server) dial(addr string) {
+	var conn *network.Conn
+	var err error
+	if srv.config.TLS != nil {
+		conn, err = network.DialSecure(addr, srv.config.TLS)
+	} else {
+		conn, err = network.Dial(addr)
+	}
+	srv.mu.Lock()
+	delete(srv.dialing, addr)
+	srv.mu.Unlock()
+	if err != nil {
+		log.Printf("failed to connect to %v; err: %v", addr, err)
+		srv.forget(addr)
+		srv.wg.Done()
+		return
+	}
+	srv.runPeer(conn, false, addr)
+}
+
+// forget removes addr from addresses to dial (bootnodes are kept)
+func (srv *Server) forget(addr string) {
+	for _, bootnode := range srv.config.Bootnodes {
+		if addr == bootnode {
+			return
+		}
+	}
+	srv.mu.Lock()
+	delete(srv.known, addr)
+	srv.mu.Unlock()
+}
+
+// runPeer exchanges status with peer, and handles its messages until it
+// is disconnected. addr is the dialed address of outbound peer.
+func (srv *Server) runPeer(conn *network.Conn, inbound bool, addr string) {
+	defer srv.wg.Done()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-srv.quit:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	status, err := network.Handshake(conn, srv.config.Status())
+	if inbound {
+		srv.mu.Lock()
+		srv.handshaking--
+		srv.mu.Unlock()
+	}
+	if err != nil {
+		log.Printf("handshake failed with %v; err: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		if !inbound {
+			srv.forget(addr)
+		}
+		return
+	}
+
+	p := &Peer{Conn: conn, Status: status, srv: srv, inbound: inbound, listenAddr: addr}
+	if err := srv.addPeer(p); err != nil {
+		log.Printf("reject %v; err: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	log.Printf("CONNECTED TO %v (inbound: %v)", conn.RemoteAddr(), inbound)
+
+	// full node announces itself to the dialed peer
+	conn.SetReadTimeout(IdleTimeout)
+	if !inbound {
+		err = p.WriteMsg(network.GetPeersMsg, srv.getPeersData())
+	}
+	if err == nil {
+		err = srv.readLoop(p)
+	}
+	conn.Close()
+	srv.removePeer(p)
+	log.Printf("disconnected from %v; err: %v", conn.RemoteAddr(), err)
+}
+
+func (srv *Server) addPeer(p *Peer) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	select {
+	case <-srv.quit:
+		return ErrServerStopped
+	default:
+	}
+	if srv.isBanned(p.host()) {
+		return ErrBanned
+	}
+	if len(srv.peers) >= srv.config.MaxPeers {
+		return ErrTooManyPeers
+	}
+	srv.peers[p] = struct{}{}
+	return nil
+}
+
+func (srv *Server) removePeer(p *Peer) {
+	srv.mu.Lock()
+	delete(srv.peers, p)
+	srv.mu.Unlock()
+	if srv.config.Disconnected != nil {
+		srv.config.Disconnected(p)
+	}
+	srv.requestDial()
+}
+
+func (srv *Server) readLoop(p *Peer) error {
+	for {
+		msg, err := p.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch msg.Code {
+		case network.GetPeersMsg:
+			err = srv.handleGetPeers(p, msg)
+		case network.PeersMsg:
+			err = srv.handlePeers(msg)
+		default:
+			if srv.config.Handler == nil {
+				err = network.ErrUnexpectedMsg
+			} else {
+				err = srv.config.Handler(p, msg)
+			}
+		}
+		if err != nil {
+			if !isConnError(err) && err != ErrSelfConnection && err != ErrDuplicatePeer {
+				srv.Penalize(p, InvalidMsgPenalty)
+			}
+			return err
+		}
+	}
+}
+
+func (srv *Server) getPeersData() *network.GetPeersData {
+	return &network.GetPeersData{ListenPort: srv.listenPort, ID: srv.id}
+}
+
+// handleGetPeers records listening address of inbound peer,
+// and replies addresses of other full nodes
+func (srv *Server) handleGetPeers(p *Peer, msg network.Msg) error {
+	var req network.GetPeersData
+	if err := msg.Decode(&req); err != nil {
+		return err
+	}
+
+	srv.mu.Lock()
+	if req.ID == srv.id {
+		// this node dialed itself, so the dialed address is not dialed again
+		for q := range srv.peers {
+			if !q.inbound && q.LocalAddr().String() == p.RemoteAddr().String() {
+				srv.self[q.listenAddr] = true
+				delete(srv.known, q.listenAddr)
+				q.Close()
+			}
+		}
+		srv.mu.Unlock()
+		return ErrSelfConnection
+	}
+	if p.inbound && req.ListenPort != 0 && p.listenAddr == "" {
+		addr := net.JoinHostPort(p.host(), strconv.FormatUint(req.ListenPort, 10))
+		// both nodes dialed each other, so the one dialed by node of larger ID is kept
+		for q := range srv.peers {
+			if q.listenAddr != addr {
+				continue
+			}
+			if srv.id > req.ID {
+				srv.mu.Unlock()
+				return ErrDuplicatePeer
+			}
+			q.Close()
+		}
+		p.listenAddr = addr
+		srv.addKnown(addr)
+	}
+
+	addrs := []string{}
+	for q := range srv.peers {
+		if len(addrs) < MaxPeersServe && q != p && q.listenAddr != "" {
+			addrs = append(addrs, q.listenAddr)
+		}
+	}
+	srv.mu.Unlock()
+	return p.WriteMsg(network.PeersMsg, addrs)
+}
+
+// handlePeers adds received addresses to dial
+func (srv *Server) handlePeers(msg network.Msg) error {
+	var addrs []string
+	if err := msg.Decode(&addrs); err != nil {
+		return err
+	}
+	if len(addrs) > MaxPeersServe {
+		return ErrTooManyAddrs
+	}
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return err
+		}
+	}
+
+	srv.mu.Lock()
+	for _, addr := range addrs {
+		srv.addKnown(addr)
+	}
+	srv.mu.Unlock()
+	srv.requestDial()
+	return nil
+}
+
+func (srv *Server) addKnown(addr string) {
+	if len(srv.known) < MaxKnownAddrs && !srv.self[addr] && addr != srv.config.ListenAddr {
+		srv.known[addr] = true
+	}
+}
+
+// isConnError returns whether err is caused by connection, not by peer's message
+func isConnError(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF || err == io.ErrClosedPipe
+}
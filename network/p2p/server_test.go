@@ -0,0 +1,166 @@
+package p2p
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/params"
+)
+
+func testStatus() *network.StatusData {
+	return &network.StatusData{ProtocolVersion: network.ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+}
+
+func startServer(t *testing.T, bootnodes ...string) *Server {
+	srv := NewServer(Config{
+		ListenAddr: "127.0.0.1:0",
+		Bootnodes:  bootnodes,
+		Status:     testStatus,
+		Handler:    func(p *Peer, msg network.Msg) error { return network.ErrUnexpectedMsg },
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// waitFor polls cond until it is true or timeout
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestDiscovery(t *testing.T) {
+	a := startServer(t)
+	defer a.Stop()
+	b := startServer(t, a.Addr().String())
+	defer b.Stop()
+	c := startServer(t, a.Addr().String())
+	defer c.Stop()
+
+	// c learns b from a, and every server is connected to the others
+	fullPeers := func(srv *Server) int {
+		n := 0
+		for _, p := range srv.Peers() {
+			if p.ListenAddr() != "" {
+				n++
+			}
+		}
+		return n
+	}
+	if !waitFor(func() bool { return fullPeers(a) == 2 && fullPeers(b) == 2 && fullPeers(c) == 2 }) {
+		t.Fatalf("not fully connected: a %d, b %d, c %d", fullPeers(a), fullPeers(b), fullPeers(c))
+	}
+}
+
+func TestBan(t *testing.T) {
+	srv := startServer(t)
+	defer srv.Stop()
+
+	// unexpected messages are penalized until the host is banned
+	for i := 0; i < BanScore/InvalidMsgPenalty; i++ {
+		conn, err := network.Dial(srv.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := network.Handshake(conn, testStatus()); err != nil {
+			t.Fatal(err)
+		}
+		conn.WriteMsg(network.GetBlocksMsg, &network.GetBlocksData{})
+		if _, err := conn.ReadMsg(); err == nil {
+			t.Fatal("misbehaving peer is not disconnected")
+		}
+		conn.Close()
+	}
+	if !srv.Banned("127.0.0.1") {
+		t.Fatalf("host is not banned, score %d", srv.Score("127.0.0.1"))
+	}
+
+	conn, err := network.Dial(srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := network.Handshake(conn, testStatus()); err == nil {
+		t.Fatal("banned host is connected")
+	}
+}
+
+func TestScoreDecay(t *testing.T) {
+	srv := NewServer(Config{})
+	srv.penalize("10.0.0.1", 3*ScoreDecay)
+
+	// score recovers by ScoreDecay every ScoreDecayInterval
+	srv.mu.Lock()
+	s := srv.scores["10.0.0.1"]
+	s.updated = s.updated.Add(-2 * ScoreDecayInterval)
+	srv.scores["10.0.0.1"] = s
+	srv.mu.Unlock()
+	if score := srv.Score("10.0.0.1"); score != -ScoreDecay {
+		t.Fatalf("score %d (expected %d)", score, -ScoreDecay)
+	}
+
+	// recovered host is forgotten
+	srv.mu.Lock()
+	s = srv.scores["10.0.0.1"]
+	s.updated = s.updated.Add(-ScoreDecayInterval)
+	srv.scores["10.0.0.1"] = s
+	srv.mu.Unlock()
+	srv.decayScores()
+	if len(srv.scores) != 0 {
+		t.Fatalf("%d hosts are remembered", len(srv.scores))
+	}
+}
+
+func TestPendingInbound(t *testing.T) {
+	srv := startServer(t)
+	defer srv.Stop()
+
+	// connections which do not handshake fill pending inbound slots
+	pending := []*network.Conn{}
+	for i := 0; i < MaxPendingInbound; i++ {
+		conn, err := network.Dial(srv.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		pending = append(pending, conn)
+	}
+	handshaking := func() int {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.handshaking
+	}
+	if !waitFor(func() bool { return handshaking() == MaxPendingInbound }) {
+		t.Fatalf("%d connections in handshake", handshaking())
+	}
+	conn, err := network.Dial(srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := network.Handshake(conn, testStatus()); err == nil {
+		t.Fatal("connection over pending limit is accepted")
+	}
+	conn.Close()
+
+	// slot is freed when a pending connection is closed
+	pending[0].Close()
+	if !waitFor(func() bool { return handshaking() < MaxPendingInbound }) {
+		t.Fatal("closed connection is still pending")
+	}
+	conn, err = network.Dial(srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := network.Handshake(conn, testStatus()); err != nil {
+		t.Fatal(err)
+	}
+}
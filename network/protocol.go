@@ -0,0 +1,502 @@
+package network
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/nipopow"
+	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/state"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/rlp"
+)
+
+// ProtocolVersion is the version of wire protocol.
+// peers which have different version are rejected in handshake.
+const ProtocolVersion = uint64(1)
+
+// message codes
+const (
+	StatusMsg        = 0x00
+	GetHeadersMsg    = 0x01
+	HeadersMsg       = 0x02
+	GetBlocksMsg     = 0x03
+	BlocksMsg        = 0x04
+	GetStateMsg      = 0x05
+	StateMsg         = 0x06
+	NewBlockMsg      = 0x07
+	GetProofMsg      = 0x08
+	ProofMsg         = 0x09
+	GetInterlinksMsg = 0x0a
+	SubscribeMsg     = 0x0b // peer wants new blocks to be pushed (NewBlockMsg)
+	GetDeltaMsg      = 0x0c
+	DeltaMsg         = 0x0d
+	GetAccountsMsg   = 0x0e
+	AccountsMsg      = 0x0f
+	GetPeersMsg      = 0x10 // peer exchange (see network/p2p)
+	PeersMsg         = 0x11
+
+	// gossip between full nodes (see network/p2p)
+	NewTxHashesMsg    = 0x12
+	GetTxsMsg         = 0x13
+	TxsMsg            = 0x14
+	NewBlockHashesMsg = 0x15
+)
+
+// maximum number of items which a node serves at once
+const (
+	MaxHeadersServe  = 192
+	MaxBlocksServe   = 128
+	MaxStateServe    = 1024
+	MaxDeltaStates   = 16 * 1024 // delta is not served if more states are changed
+	MaxDeltaBlocks   = 4 * 1024  // delta is not served if the head is further behind
+	MaxAccountsServe = 256
+	MaxTxsServe      = 256
+)
+
+var (
+	ErrUnexpectedMsg = errors.New("unexpected message code")
+
+	ErrProtocolVersionMismatch = errors.New("peer's protocol version does not match")
+
+	ErrGenesisMismatch = errors.New("peer's genesis block does not match")
+)
+
+// Msg is a message of wire protocol (see Conn for framing)
+type Msg struct {
+	Code    uint64
+	Payload []byte
+}
+
+// Decode decodes rlp payload of the message into val
+func (msg Msg) Decode(val interface{}) error {
+	return rlp.DecodeBytes(msg.Payload, val)
+}
+
+// StatusData is the payload of StatusMsg (handshake)
+type StatusData struct {
+	ProtocolVersion uint64
+	GenesisHash     common.Hash
+	HeadHash        common.Hash
+	HeadNumber      uint64
+	TD              *big.Int
+}
+
+// GetHeadersData is the payload of GetHeadersMsg
+// headers of number Origin, Origin+Skip+1, ... (at most Amount headers)
+type GetHeadersData struct {
+	Origin uint64
+	Amount uint64
+	Skip   uint64
+}
+
+// GetBlocksData is the payload of GetBlocksMsg
+type GetBlocksData struct {
+	Numbers []uint64
+}
+
+// GetInterlinksData is the payload of GetInterlinksMsg. interlink blocks from
+// genesis to block HeadHash are served (to current block if HeadHash is empty),
+// and nothing is served if the block is not in canonical chain.
+type GetInterlinksData struct {
+	HeadHash common.Hash
+}
+
+// GetStateData is the payload of GetStateMsg. states in the state trie of
+// block HeadHash whose hashed address (keccak256) >= Origin, in the order of
+// hashed address (at most Limit states). nothing is served if the block is unknown.
+type GetStateData struct {
+	HeadHash common.Hash
+	Origin   common.Hash
+	Limit    uint64
+}
+
+// StateEntry is an item of StateMsg's payload
+type StateEntry struct {
+	Address common.Address
+	TxHash  common.Hash
+	Tx      *types.Transaction
+}
+
+// NewBlockData is the payload of NewBlockMsg
+type NewBlockData struct {
+	Block *types.Block
+	TD    *big.Int
+}
+
+// GetProofData is the payload of GetProofMsg (nipopow parameters)
+type GetProofData struct {
+	M uint64
+	K uint64
+}
+
+// GetDeltaData is the payload of GetDeltaMsg (light node's head)
+type GetDeltaData struct {
+	HeadHash   common.Hash
+	HeadNumber uint64
+	Addresses  []common.Address // only these addresses' states are served (all if empty)
+}
+
+// DeltaData is the payload of DeltaMsg. Blocks are interlink blocks from the
+// head to current block, and States are states changed after the head.
+// Blocks is empty if delta cannot be served.
+type DeltaData struct {
+	Blocks []*types.Block
+	States []StateEntry
+}
+
+// GetAccountsData is the payload of GetAccountsMsg. states of Addresses
+// are proven against the state root of the head.
+type GetAccountsData struct {
+	HeadHash   common.Hash
+	HeadNumber uint64
+	Addresses  []common.Address
+}
+
+// AccountsData is the payload of AccountsMsg. Txs are the txs of accounts'
+// states (without duplication).
+type AccountsData struct {
+	Accounts []AccountProof
+	Txs      []TxInclusion
+}
+
+// AccountProof is the address's state (TxHash, empty if it has no state)
+// with merkle proof against the head's state root
+type AccountProof struct {
+	Address    common.Address
+	TxHash     common.Hash
+	StateProof *state.StateProof
+}
+
+// TxInclusion is a tx with merkle proof against Header of the block which
+// includes it (Header and Proof are nil if tx is not included in a block,
+// e.g. initial allocation)
+type TxInclusion struct {
+	Tx     *types.Transaction
+	Header *types.Header  `rlp:"nil"`
+	Proof  *types.TxProof `rlp:"nil"`
+}
+
+// GetPeersData is the payload of GetPeersMsg. full node announces its
+// listening port (0 if it does not listen, e.g. light node) and random node
+// ID (to detect connection to itself). PeersMsg's payload is a list of
+// "host:port" of full nodes.
+type GetPeersData struct {
+	ListenPort uint64
+	ID         uint64
+}
+
+// BlockAnnounce is an item of NewBlockHashesMsg's payload. NewTxHashesMsg
+// and GetTxsMsg's payload is a list of tx hashes, and TxsMsg's is txs.
+type BlockAnnounce struct {
+	Hash   common.Hash
+	Number uint64
+}
+
+// Request sends a request message and decodes the response into resp
+func Request(c *Conn, code uint64, data interface{}, respCode uint64, resp interface{}) error {
+	if err := c.WriteMsg(code, data); err != nil {
+		return err
+	}
+	msg, err := c.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Code != respCode {
+		return ErrUnexpectedMsg
+	}
+	return msg.Decode(resp)
+}
+
+// NewStatus returns status of the blockchain
+func NewStatus(bc *core.BlockChain) *StatusData {
+	head := bc.CurrentBlock()
+	return &StatusData{
+		ProtocolVersion: ProtocolVersion,
+		GenesisHash:     bc.Genesis().Hash(),
+		HeadHash:        head.Hash(),
+		HeadNumber:      head.Number(),
+		TD:              bc.GetTd(head.Hash(), head.Number()),
+	}
+}
+
+// Handshake exchanges status with peer, and rejects incompatible peer
+func Handshake(c *Conn, status *StatusData) (*StatusData, error) {
+	defer Measure(PhaseHandshake)()
+	// both sides send status first, so send it concurrently with reading
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.WriteMsg(StatusMsg, status)
+	}()
+	msg, err := c.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	if msg.Code != StatusMsg {
+		return nil, ErrUnexpectedMsg
+	}
+
+	peer := new(StatusData)
+	if err := msg.Decode(peer); err != nil {
+		return nil, err
+	}
+	if peer.ProtocolVersion != status.ProtocolVersion {
+		return nil, ErrProtocolVersionMismatch
+	}
+	if peer.GenesisHash != status.GenesisHash {
+		return nil, ErrGenesisMismatch
+	}
+	return peer, nil
+}
+
+// HandleMsg serves a request message from peer with the blockchain
+func HandleMsg(c *Conn, bc *core.BlockChain, msg Msg) error {
+	return HandleMsgLocked(c, bc, msg, nil)
+}
+
+// HandleMsgLocked serves a request message like HandleMsg, and holds lock
+// (if any) only while it accesses the blockchain, not while it writes the
+// response to peer.
+func HandleMsgLocked(c *Conn, bc *core.BlockChain, msg Msg, lock sync.Locker) error {
+	if phase, ok := msgPhases[msg.Code]; ok {
+		defer Measure(phase)()
+	}
+	if lock != nil {
+		lock.Lock()
+	}
+	code, data, err := respond(bc, msg)
+	if lock != nil {
+		lock.Unlock()
+	}
+	if err != nil || data == nil {
+		return err
+	}
+	return c.WriteMsg(code, data)
+}
+
+// respond returns the response (code and payload) to a request message.
+// payload is nil if nothing is responded.
+func respond(bc *core.BlockChain, msg Msg) (uint64, interface{}, error) {
+	switch msg.Code {
+	case GetHeadersMsg:
+		var req GetHeadersData
+		if err := msg.Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		headers := []*types.Header{}
+		for number := req.Origin; uint64(len(headers)) < req.Amount && len(headers) < MaxHeadersServe; number += req.Skip + 1 {
+			header := bc.GetHeaderByNumber(number)
+			if header == nil {
+				break
+			}
+			headers = append(headers, header)
+		}
+		return HeadersMsg, headers, nil
+
+	case GetBlocksMsg:
+		var req GetBlocksData
+		if err := msg.Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		return BlocksMsg, getBlocks(bc, req.Numbers, MaxBlocksServe), nil
+
+	case GetInterlinksMsg:
+		var req GetInterlinksData
+		if err := msg.Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		return BlocksMsg, getInterlinks(bc, &req), nil
+
+	case GetStateMsg:
+		var req GetStateData
+		if err := msg.Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		return StateMsg, getState(bc, &req), nil
+
+	case GetDeltaMsg:
+		var req GetDeltaData
+		if err := msg.Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		return DeltaMsg, getDelta(bc, &req), nil
+
+	case GetAccountsMsg:
+		var req GetAccountsData
+		if err := msg.Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		return AccountsMsg, getAccounts(bc, &req), nil
+
+	case GetProofMsg:
+		var req GetProofData
+		if err := msg.Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		return ProofMsg, nipopow.Prove(bc, req.M, req.K), nil
+
+	case NewBlockMsg:
+		var data NewBlockData
+		if err := msg.Decode(&data); err != nil {
+			return 0, nil, err
+		}
+		if err := bc.Insert(data.Block); err != nil {
+			log.Printf("failed to insert new block; err: %v", err)
+		}
+		return 0, nil, nil
+
+	default:
+		return 0, nil, ErrUnexpectedMsg
+	}
+}
+
+// getBlocks returns canonical blocks of numbers (without unknown blocks)
+func getBlocks(bc *core.BlockChain, numbers []uint64, limit int) []*types.Block {
+	blocks := []*types.Block{}
+	for _, number := range numbers {
+		if len(blocks) >= limit {
+			break
+		}
+		if header := bc.GetHeaderByNumber(number); header != nil {
+			blocks = append(blocks, bc.GetBlock(header.Hash(), number))
+		}
+	}
+	return blocks
+}
+
+// getInterlinks returns interlink blocks from genesis to the requested block
+func getInterlinks(bc *core.BlockChain, req *GetInterlinksData) []*types.Block {
+	header := bc.CurrentHeader()
+	if req.HeadHash != (common.Hash{}) {
+		number := rawdb.ReadHeaderNumber(bc.GetDB(), req.HeadHash)
+		if number == nil {
+			return []*types.Block{}
+		}
+		if header = bc.GetHeaderByNumber(*number); header == nil || header.Hash() != req.HeadHash {
+			return []*types.Block{}
+		}
+	}
+	// interlink chain is verified as a whole, so it is not limited
+	numbers := nipopow.InterlinkChainTo(bc, header)
+	return getBlocks(bc, numbers, len(numbers))
+}
+
+// getState returns a page of states in the state trie of the requested block
+func getState(bc *core.BlockChain, req *GetStateData) []StateEntry {
+	limit := req.Limit
+	if limit > MaxStateServe {
+		limit = MaxStateServe
+	}
+	entries := []StateEntry{}
+	header := bc.GetHeaderByHash(req.HeadHash)
+	if header == nil || limit == 0 {
+		return entries
+	}
+	err := bc.IterateState(header, req.Origin, func(address common.Address, txHash common.Hash) bool {
+		tx, _, _, _ := rawdb.ReadTransaction(bc.GetDB(), txHash)
+		if tx == nil {
+			return false
+		}
+		entries = append(entries, StateEntry{Address: address, TxHash: txHash, Tx: tx})
+		return uint64(len(entries)) < limit
+	})
+	if err != nil {
+		log.Printf("failed to iterate state of block %v; err: %v", req.HeadHash, err)
+	}
+	return entries
+}
+
+// getDelta returns interlink blocks from the head to current block, and states
+// of participants of txs after the head. nothing is returned if the head is not
+// in canonical chain, or too many blocks are after it or too many states are
+// changed (then client resyncs with proof).
+func getDelta(bc *core.BlockChain, req *GetDeltaData) *DeltaData {
+	delta := &DeltaData{Blocks: []*types.Block{}, States: []StateEntry{}}
+	number := req.HeadNumber
+	if header := bc.GetHeaderByNumber(number); header == nil || header.Hash() != req.HeadHash {
+		return delta
+	}
+	requested := make(map[common.Address]bool)
+	for _, address := range req.Addresses {
+		requested[address] = true
+	}
+
+	states := []StateEntry{}
+	changed := make(map[common.Address]bool)
+	current := bc.CurrentBlock().Number()
+	if current < number || current-number > MaxDeltaBlocks {
+		return delta
+	}
+	for n := number + 1; n <= current; n++ {
+		block := bc.BlockAt(n)
+		if block == nil {
+			// canonical chain is changed (reorg)
+			return delta
+		}
+		for _, tx := range block.Transactions() {
+			for _, key := range tx.Participants() {
+				address := crypto.PubkeyToAddress(key)
+				if changed[address] || (len(requested) > 0 && !requested[address]) {
+					continue
+				}
+				if len(states) >= MaxDeltaStates {
+					return delta
+				}
+				changed[address] = true
+				txHash := rawdb.ReadState(bc.GetDB(), key)
+				if stateTx, _, _, _ := rawdb.ReadTransaction(bc.GetDB(), txHash); stateTx != nil {
+					states = append(states, StateEntry{Address: address, TxHash: txHash, Tx: stateTx})
+				}
+			}
+		}
+	}
+
+	numbers := nipopow.InterlinkChainFrom(bc, number)
+	delta.Blocks = getBlocks(bc, numbers, len(numbers))
+	delta.States = states
+	return delta
+}
+
+// getAccounts returns requested addresses' states with proofs against the
+// state root of the head, and their txs with inclusion proofs. nothing is
+// returned if the head is not in canonical chain.
+func getAccounts(bc *core.BlockChain, req *GetAccountsData) *AccountsData {
+	data := &AccountsData{Accounts: []AccountProof{}, Txs: []TxInclusion{}}
+	head := bc.GetHeaderByNumber(req.HeadNumber)
+	if head == nil || head.Hash() != req.HeadHash {
+		return data
+	}
+
+	included := make(map[common.Hash]bool)
+	for _, address := range req.Addresses {
+		if len(data.Accounts) >= MaxAccountsServe {
+			break
+		}
+		txHash, stateProof, err := bc.GetStateProof(head, address)
+		if err != nil {
+			log.Printf("failed to prove state of %v; err: %v", address.ToHex(), err)
+			return &AccountsData{Accounts: []AccountProof{}, Txs: []TxInclusion{}}
+		}
+		data.Accounts = append(data.Accounts, AccountProof{Address: address, TxHash: txHash, StateProof: stateProof})
+		if txHash == (common.Hash{}) || included[txHash] {
+			continue
+		}
+
+		tx, _, _, _ := rawdb.ReadTransaction(bc.GetDB(), txHash)
+		if tx == nil {
+			continue
+		}
+		header, proof, _ := bc.GetTxProof(txHash)
+		data.Txs = append(data.Txs, TxInclusion{Tx: tx, Header: header, Proof: proof})
+		included[txHash] = true
+	}
+	return data
+}
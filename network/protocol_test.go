@@ -0,0 +1,144 @@
+package network
+
+import (
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/nipopow"
+	"github.com/altair-lab/xoreum/core/state"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/trie"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+// serve runs full node's side of the protocol on conn
+// (subscription is accepted if broadcaster is given)
+func serve(conn *Conn, bc *core.BlockChain, broadcaster *Broadcaster) {
+	defer conn.Close()
+	if _, err := Handshake(conn, NewStatus(bc)); err != nil {
+		return
+	}
+	for {
+		msg, err := conn.ReadMsg()
+		if err != nil {
+			return
+		}
+		if msg.Code == SubscribeMsg && broadcaster != nil {
+			err = broadcaster.Subscribe(conn, bc)
+		} else {
+			err = HandleMsg(conn, bc, msg)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func newPipe() (*Conn, *Conn) {
+	client, server := net.Pipe()
+	return NewConn(client), NewConn(server)
+}
+
+func TestProtocol(t *testing.T) {
+	bc := MakeTestBlockChain(20, 10, 0, false, memorydb.New())
+	client, server := newPipe()
+	defer client.Close()
+	go serve(server, bc, nil)
+
+	status := &StatusData{ProtocolVersion: ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+	peer, err := Handshake(client, status)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if peer.HeadHash != bc.CurrentBlock().Hash() || peer.HeadNumber != 20 {
+		t.Fatalf("wrong peer status: %+v", peer)
+	}
+
+	var headers []*types.Header
+	if err := Request(client, GetHeadersMsg, &GetHeadersData{Origin: 1, Amount: 5, Skip: 1}, HeadersMsg, &headers); err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 5 || headers[4].Number != 9 || headers[4].Hash() != bc.BlockAt(9).Hash() {
+		t.Fatal("wrong headers")
+	}
+
+	var blocks []*types.Block
+	if err := Request(client, GetInterlinksMsg, &GetInterlinksData{}, BlocksMsg, &blocks); err != nil {
+		t.Fatal(err)
+	}
+	if err := nipopow.VerifyInterlinkChain(blocks, params.MainnetGenesisHash); err != nil {
+		t.Fatalf("failed to verify interlink blocks: %v", err)
+	}
+
+	// interlink chain is pinned to the requested block (empty if it is unknown)
+	var pinned []*types.Block
+	if err := Request(client, GetInterlinksMsg, &GetInterlinksData{HeadHash: bc.BlockAt(10).Hash()}, BlocksMsg, &pinned); err != nil {
+		t.Fatal(err)
+	}
+	if err := nipopow.VerifyInterlinkChain(pinned, params.MainnetGenesisHash); err != nil || pinned[len(pinned)-1].Hash() != bc.BlockAt(10).Hash() {
+		t.Fatalf("wrong interlink blocks to block 10, err %v", err)
+	}
+	if err := Request(client, GetInterlinksMsg, &GetInterlinksData{HeadHash: common.Hash{1}}, BlocksMsg, &pinned); err != nil || len(pinned) != 0 {
+		t.Fatalf("%d interlink blocks to unknown block, err %v", len(pinned), err)
+	}
+
+	db := memorydb.New()
+	if err := SyncState(client, db, blocks[len(blocks)-1].Header()); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	light := core.NewIoTBlockChain(db, blocks[len(blocks)-1])
+	if light.StateRoot() != bc.StateRoot() {
+		t.Fatal("synchronized state root mismatch")
+	}
+}
+
+func TestStatePages(t *testing.T) {
+	bc := MakeTestBlockChain(5, 10, 0, false, memorydb.New())
+	old := bc.CurrentHeader()
+	for tc := NewTestChain(bc, 10); bc.StateRoot() == old.Root; {
+		tc.MineBlock(false) // random txs can be empty
+	}
+
+	// small pages of old block's state trie are served in order without
+	// overlap, and they make old block's state root (not current one's)
+	st, _ := state.NewStateTrie(common.Hash{}, trie.NewDatabase(memorydb.New()))
+	origin, count := common.Hash{}, 0
+	for {
+		entries := getState(bc, &GetStateData{HeadHash: old.Hash(), Origin: origin, Limit: 3})
+		for _, entry := range entries {
+			if key := crypto.Keccak256Hash(entry.Address.Bytes()); key.ToBigInt().Cmp(origin.ToBigInt()) < 0 {
+				t.Fatalf("state %d is before origin", count)
+			}
+			st.Update(entry.Address, entry.TxHash)
+			count++
+		}
+		if len(entries) < 3 {
+			break
+		}
+		origin, _ = incHash(crypto.Keccak256Hash(entries[len(entries)-1].Address.Bytes()))
+	}
+	if count != 10 || st.Hash() != old.Root {
+		t.Fatalf("%d states of old block are served", count)
+	}
+
+	if entries := getState(bc, &GetStateData{HeadHash: common.Hash{1}, Limit: 3}); len(entries) != 0 {
+		t.Fatal("states of unknown block are served")
+	}
+}
+
+func TestHandshakeGenesisMismatch(t *testing.T) {
+	bc := MakeTestBlockChain(1, 3, 0, false, memorydb.New())
+	client, server := newPipe()
+	defer client.Close()
+	go serve(server, bc, nil)
+
+	status := &StatusData{ProtocolVersion: ProtocolVersion, TD: new(big.Int)}
+	if _, err := Handshake(client, status); err != ErrGenesisMismatch {
+		t.Fatalf("handshake with wrong genesis, err %v", err)
+	}
+}
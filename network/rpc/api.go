@@ -0,0 +1,274 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/rlp"
+)
+
+// Block is a block in JSON-RPC results. Transactions are tx hashes, or txs if
+// they are requested in full.
+type Block struct {
+	Hash         string        `json:"hash"`
+	ParentHash   string        `json:"parentHash"`
+	Number       uint64        `json:"number"`
+	Time         uint64        `json:"timestamp"`
+	Miner        string        `json:"miner"`
+	StateRoot    string        `json:"stateRoot"`
+	TxRoot       string        `json:"transactionsRoot"`
+	Difficulty   uint64        `json:"difficulty"`
+	Nonce        uint64        `json:"nonce"`
+	Interlink    []uint64      `json:"interlink"` // unique block numbers
+	Transactions []interface{} `json:"transactions"`
+}
+
+// Transaction is a tx in JSON-RPC results. block fields are null if tx is
+// pending, or its block is unknown (e.g. state tx of light node).
+type Transaction struct {
+	Hash         string    `json:"hash"`
+	PostStates   []Account `json:"postStates"` // participants' states after tx
+	PrevTxHashes []string  `json:"prevTxHashes"`
+	BlockHash    *string   `json:"blockHash"`
+	BlockNumber  *uint64   `json:"blockNumber"`
+	Index        *uint64   `json:"transactionIndex"`
+}
+
+// Account is an account's state
+type Account struct {
+	Address string `json:"address"`
+	Nonce   uint64 `json:"nonce"`
+	Balance uint64 `json:"balance"`
+	TxHash  string `json:"txHash,omitempty"` // tx which made the state (only in state_getAccount)
+}
+
+// TxPoolStatus is the status of txpool
+type TxPoolStatus struct {
+	Pending int `json:"pending"`
+	Future  int `json:"future"` // txs waiting for their prev txs
+}
+
+// chainHead returns current block. params: [full txs (optional)]
+func (s *Server) chainHead(params []json.RawMessage) (interface{}, error) {
+	full, err := fullTxsParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return newBlock(s.bc.CurrentBlock(), full), nil
+}
+
+// getBlockByNumber returns canonical block of number. params: [number, full txs (optional)]
+func (s *Server) getBlockByNumber(params []json.RawMessage) (interface{}, error) {
+	var number uint64
+	if len(params) == 0 || json.Unmarshal(params[0], &number) != nil {
+		return nil, ErrInvalidParams
+	}
+	full, err := fullTxsParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	header := s.bc.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, nil
+	}
+	return newBlock(s.bc.GetBlock(header.Hash(), number), full), nil
+}
+
+// getBlockByHash returns block of hash. params: [hash, full txs (optional)]
+func (s *Server) getBlockByHash(params []json.RawMessage) (interface{}, error) {
+	hash, err := hashParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	full, err := fullTxsParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	number := rawdb.ReadHeaderNumber(s.bc.GetDB(), hash)
+	if number == nil {
+		return nil, nil
+	}
+	return newBlock(s.bc.GetBlock(hash, *number), full), nil
+}
+
+// getTxByHash returns tx in db or txpool. params: [hash]
+func (s *Server) getTxByHash(params []json.RawMessage) (interface{}, error) {
+	hash, err := hashParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	tx, blockHash, number, index := rawdb.ReadTransaction(s.bc.GetDB(), hash)
+	if tx != nil {
+		result := newTransaction(tx)
+		if blockHash != (common.Hash{}) {
+			blockHex := blockHash.ToHex()
+			result.BlockHash, result.BlockNumber, result.Index = &blockHex, &number, &index
+		}
+		return result, nil
+	}
+	if tx := s.pool.Get(hash); tx != nil {
+		return newTransaction(tx), nil
+	}
+	return nil, nil
+}
+
+// getAccount returns address's current state (post state of its state tx).
+// params: [address]
+func (s *Server) getAccount(params []json.RawMessage) (interface{}, error) {
+	b, err := bytesParam(params, 0)
+	if err != nil || len(b) != common.AddressLength {
+		return nil, ErrInvalidParams
+	}
+	address := common.BytesToAddress(b)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.account(address), nil
+}
+
+// account returns address's current state (nil if it has no state).
+// lock should be held.
+func (s *Server) account(address common.Address) *Account {
+	txHash := rawdb.ReadStateByAddress(s.bc.GetDB(), address)
+	if txHash == (common.Hash{}) {
+		return nil
+	}
+	tx, _, _, _ := rawdb.ReadTransaction(s.bc.GetDB(), txHash)
+	if tx == nil {
+		return nil
+	}
+	for i, key := range tx.Participants() {
+		if crypto.PubkeyToAddress(key) == address {
+			account := newAccount(address, tx, i)
+			account.TxHash = txHash.ToHex()
+			return &account
+		}
+	}
+	return nil
+}
+
+// sendTx adds signed tx into txpool, and returns its hash.
+// params: [hex of rlp encoded tx]
+func (s *Server) sendTx(params []json.RawMessage) (interface{}, error) {
+	b, err := bytesParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(b, tx); err != nil {
+		return nil, ErrInvalidParams
+	}
+	if err := tx.ValidateTx(); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	_, err = s.pool.Add(tx)
+	s.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if s.Sent != nil {
+		s.Sent(tx)
+	}
+	return tx.Hash.ToHex(), nil
+}
+
+// txpoolStatus returns the number of txs in txpool
+func (s *Server) txpoolStatus(params []json.RawMessage) (interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pending, future := s.pool.Stats()
+	return &TxPoolStatus{Pending: pending, Future: future}, nil
+}
+
+func newBlock(block *types.Block, full bool) *Block {
+	if block == nil {
+		return nil
+	}
+	header := block.Header()
+	result := &Block{
+		Hash:         block.Hash().ToHex(),
+		ParentHash:   header.ParentHash.ToHex(),
+		Number:       header.Number,
+		Time:         header.Time,
+		Miner:        header.Coinbase.ToHex(),
+		StateRoot:    header.Root.ToHex(),
+		TxRoot:       header.TxHash.ToHex(),
+		Difficulty:   header.Difficulty,
+		Nonce:        header.Nonce,
+		Interlink:    block.GetUniqueInterlink(),
+		Transactions: []interface{}{},
+	}
+	for _, tx := range block.Transactions() {
+		if full {
+			result.Transactions = append(result.Transactions, newTransaction(tx))
+		} else {
+			result.Transactions = append(result.Transactions, tx.Hash.ToHex())
+		}
+	}
+	return result
+}
+
+func newTransaction(tx *types.Transaction) *Transaction {
+	result := &Transaction{Hash: tx.Hash.ToHex(), PostStates: []Account{}, PrevTxHashes: []string{}}
+	for i, key := range tx.Participants() {
+		result.PostStates = append(result.PostStates, newAccount(crypto.PubkeyToAddress(key), tx, i))
+	}
+	for _, hash := range tx.PrevTxHashes() {
+		result.PrevTxHashes = append(result.PrevTxHashes, hash.ToHex())
+	}
+	return result
+}
+
+// newAccount returns i-th participant's post state of tx
+func newAccount(address common.Address, tx *types.Transaction, i int) Account {
+	state := tx.PostStates()[i]
+	return Account{Address: address.ToHex(), Nonce: state.Nonce, Balance: state.Balance}
+}
+
+// bytesParam decodes i-th param, which is hex string (with or without 0x)
+func bytesParam(params []json.RawMessage, i int) ([]byte, error) {
+	var s string
+	if len(params) <= i || json.Unmarshal(params[i], &s) != nil {
+		return nil, ErrInvalidParams
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, ErrInvalidParams
+	}
+	return b, nil
+}
+
+func hashParam(params []json.RawMessage, i int) (common.Hash, error) {
+	b, err := bytesParam(params, i)
+	if err != nil || len(b) != common.HashLength {
+		return common.Hash{}, ErrInvalidParams
+	}
+	return common.BytesToHash(b), nil
+}
+
+// fullTxsParam decodes optional i-th param, whether block's txs are returned in full
+func fullTxsParam(params []json.RawMessage, i int) (bool, error) {
+	var full bool
+	if len(params) > i && json.Unmarshal(params[i], &full) != nil {
+		return false, ErrInvalidParams
+	}
+	return full, nil
+}
@@ -0,0 +1,209 @@
+// Package rpc serves node's blockchain, states and txpool over HTTP JSON-RPC 2.0
+// (e.g. for dashboards and scripts), and pushes their events over websocket.
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/types"
+)
+
+const (
+	// MaxRequestSize is the maximum size of request body
+	MaxRequestSize = 1024 * 1024
+
+	DefaultReadTimeout  = 10 * time.Second
+	DefaultWriteTimeout = 10 * time.Second
+)
+
+// error codes of JSON-RPC 2.0
+const (
+	ErrCodeParse          = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeServer         = -32000 // request is valid, but failed (e.g. invalid tx)
+)
+
+var (
+	ErrServerStarted = errors.New("rpc server is already started")
+
+	ErrInvalidParams = errors.New("invalid params")
+)
+
+// Error is an error of JSON-RPC response
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// method serves a request with its params (positional)
+type method func(params []json.RawMessage) (interface{}, error)
+
+// Server serves JSON-RPC requests with blockchain and txpool. requests are
+// served with lock held, which node holds while it uses them.
+type Server struct {
+	bc   *core.BlockChain
+	pool *core.TxPool
+	lock sync.Locker
+
+	// Sent is called (without lock) when a tx is added into txpool by txpool_send
+	// (e.g. to announce it to peers)
+	Sent func(*types.Transaction)
+
+	methods  map[string]method
+	listener net.Listener
+	http     *http.Server
+
+	mu       sync.Mutex
+	sessions map[*wsSession]struct{} // websocket connections (closed on Stop)
+}
+
+// NewServer returns a server of blockchain and txpool
+func NewServer(bc *core.BlockChain, pool *core.TxPool, lock sync.Locker) *Server {
+	s := &Server{bc: bc, pool: pool, lock: lock, sessions: make(map[*wsSession]struct{})}
+	s.methods = map[string]method{
+		"chain_head":             s.chainHead,
+		"chain_getBlockByNumber": s.getBlockByNumber,
+		"chain_getBlockByHash":   s.getBlockByHash,
+		"tx_getByHash":           s.getTxByHash,
+		"state_getAccount":       s.getAccount,
+		"txpool_send":            s.sendTx,
+		"txpool_status":          s.txpoolStatus,
+	}
+	return s
+}
+
+// Start starts serving HTTP requests on addr ("host:port")
+func (s *Server) Start(addr string) error {
+	if s.listener != nil {
+		return ErrServerStarted
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.http = &http.Server{
+		Handler:      s,
+		ReadTimeout:  DefaultReadTimeout,
+		WriteTimeout: DefaultWriteTimeout,
+	}
+	go func() {
+		if err := s.http.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("rpc server is stopped; err: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops serving requests, and closes websocket connections
+func (s *Server) Stop() {
+	if s.http != nil {
+		s.http.Close()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for session := range s.sessions {
+		session.conn.Close()
+	}
+}
+
+// Addr returns the address which server listens on
+func (s *Server) Addr() net.Addr { return s.listener.Addr() }
+
+// ServeHTTP serves a JSON-RPC request which is POSTed, or requests and
+// subscriptions over websocket
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isWebSocket(r) {
+		conn, err := upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.serveWebSocket(conn)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxRequestSize))
+	if err != nil {
+		body = nil
+	}
+	json.NewEncoder(w).Encode(s.handle(body, nil))
+}
+
+// handle serves a request with server's methods and extra ones (e.g. subscribe)
+func (s *Server) handle(body []byte, extra map[string]method) *response {
+	resp := &response{Version: "2.0", ID: json.RawMessage("null")}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		resp.Error = &Error{Code: ErrCodeParse, Message: "parse error"}
+		return resp
+	}
+	if req.ID != nil {
+		resp.ID = req.ID
+	}
+	resp.Result, resp.Error = s.call(&req, extra)
+	return resp
+}
+
+// call calls the method of request
+func (s *Server) call(req *request, extra map[string]method) (interface{}, *Error) {
+	if req.Version != "2.0" || req.Method == "" {
+		return nil, &Error{Code: ErrCodeInvalidRequest, Message: "invalid request"}
+	}
+	m, ok := extra[req.Method]
+	if !ok {
+		m, ok = s.methods[req.Method]
+	}
+	if !ok {
+		return nil, &Error{Code: ErrCodeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	var params []json.RawMessage
+	if len(req.Params) > 0 && json.Unmarshal(req.Params, &params) != nil {
+		return nil, &Error{Code: ErrCodeInvalidParams, Message: "params should be an array"}
+	}
+
+	result, err := m(params)
+	switch {
+	case err == ErrInvalidParams:
+		return nil, &Error{Code: ErrCodeInvalidParams, Message: err.Error()}
+	case err != nil:
+		return nil, &Error{Code: ErrCodeServer, Message: err.Error()}
+	}
+	// null result is encoded (e.g. unknown block)
+	if result == nil {
+		return json.RawMessage("null"), nil
+	}
+	return result, nil
+}
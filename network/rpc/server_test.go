@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/rlp"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+// call posts a request, and decodes its result into result
+func call(t *testing.T, url string, method string, result interface{}, params ...interface{}) *Error {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		ID     int
+		Result json.RawMessage
+		Error  *Error
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != 1 {
+		t.Fatalf("wrong response id %d", r.ID)
+	}
+	if r.Error == nil && result != nil {
+		if err := json.Unmarshal(r.Result, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r.Error
+}
+
+func TestServer(t *testing.T) {
+	chain := network.NewTestChain(core.NewBlockChain(memorydb.New()), 10)
+	for i := 0; i < 5; i++ {
+		chain.MineBlock(false)
+	}
+	bc := chain.Blockchain
+	// txpool of rpc server is empty, so test chain's txs can be sent into it
+	srv := NewServer(bc, core.NewTxPool(bc), new(sync.Mutex))
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var head Block
+	if err := call(t, ts.URL, "chain_head", &head); err != nil {
+		t.Fatal(err)
+	}
+	current := bc.CurrentBlock()
+	if head.Hash != current.Hash().ToHex() || head.Number != current.Number() || len(head.Transactions) != len(current.Transactions()) {
+		t.Fatalf("wrong head: %+v", head)
+	}
+
+	// block with txs in full
+	var block struct {
+		Hash         string
+		Transactions []Transaction
+	}
+	if err := call(t, ts.URL, "chain_getBlockByNumber", &block, current.Number(), true); err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash != head.Hash {
+		t.Fatal("wrong block by number")
+	}
+	var byHash Block
+	if err := call(t, ts.URL, "chain_getBlockByHash", &byHash, head.Hash); err != nil || byHash.Hash != head.Hash {
+		t.Fatalf("wrong block by hash, err %v", err)
+	}
+	var unknown *Block
+	if err := call(t, ts.URL, "chain_getBlockByNumber", &unknown, 100); err != nil || unknown != nil {
+		t.Fatalf("unknown block, err %v", err)
+	}
+
+	// included tx and participant's state
+	if len(current.Transactions()) > 0 {
+		tx := current.Transactions()[0]
+		var result Transaction
+		if err := call(t, ts.URL, "tx_getByHash", &result, tx.Hash.ToHex()); err != nil {
+			t.Fatal(err)
+		}
+		if result.Hash != tx.Hash.ToHex() || result.BlockNumber == nil || *result.BlockNumber != current.Number() {
+			t.Fatalf("wrong tx: %+v", result)
+		}
+
+		address := crypto.PubkeyToAddress(tx.Participants()[0])
+		var account Account
+		if err := call(t, ts.URL, "state_getAccount", &account, address.ToHex()); err != nil {
+			t.Fatal(err)
+		}
+		if account.TxHash == "" || account.Address != address.ToHex() {
+			t.Fatalf("wrong account: %+v", account)
+		}
+	}
+
+	// send signed txs into txpool
+	txs := chain.AddTestTxs()
+	for len(txs) == 0 {
+		txs = chain.AddTestTxs()
+	}
+	sent := 0
+	srv.Sent = func(*types.Transaction) { sent++ }
+	for _, tx := range txs {
+		raw, _ := rlp.EncodeToBytes(tx)
+		var hash string
+		if err := call(t, ts.URL, "txpool_send", &hash, "0x"+hex.EncodeToString(raw)); err != nil {
+			t.Fatal(err)
+		}
+		if hash != tx.Hash.ToHex() {
+			t.Fatal("wrong hash of sent tx")
+		}
+	}
+	var status TxPoolStatus
+	if err := call(t, ts.URL, "txpool_status", &status); err != nil || status.Pending != len(txs) || sent != len(txs) {
+		t.Fatalf("wrong txpool status: %+v, err %v", status, err)
+	}
+	var pending Transaction
+	if err := call(t, ts.URL, "tx_getByHash", &pending, txs[0].Hash.ToHex()); err != nil || pending.BlockHash != nil {
+		t.Fatalf("wrong pending tx: %+v, err %v", pending, err)
+	}
+
+	// errors
+	if err := call(t, ts.URL, "chain_unknown", nil); err == nil || err.Code != ErrCodeMethodNotFound {
+		t.Fatalf("unknown method, err %v", err)
+	}
+	if err := call(t, ts.URL, "chain_getBlockByHash", nil, "0x01"); err == nil || err.Code != ErrCodeInvalidParams {
+		t.Fatalf("invalid params, err %v", err)
+	}
+	if err := call(t, ts.URL, "txpool_send", nil, "0x01"); err == nil || err.Code != ErrCodeInvalidParams {
+		t.Fatalf("invalid tx, err %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core"
+)
+
+// kinds of subscriptions (first param of subscribe)
+const (
+	SubNewHeads      = "newHeads"      // new heads of canonical chain (block with tx hashes)
+	SubNewPendingTxs = "newPendingTxs" // hashes of txs which are added into txpool
+	SubAccount       = "account"       // address's state when it is changed (second param is address)
+)
+
+// EventBuffer is the number of events which are buffered for a subscription
+// (events are dropped if client does not receive them in time)
+const EventBuffer = 64
+
+var ErrUnknownSubscription = errors.New("unknown subscription")
+
+// notification is pushed to client when a subscribed event occurs
+type notification struct {
+	Version string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	Params  subscriptionResult `json:"params"`
+}
+
+type subscriptionResult struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+}
+
+// wsSession serves requests and subscriptions of a websocket connection
+type wsSession struct {
+	srv     *Server
+	conn    *wsConn
+	methods map[string]method // methods only for websocket
+
+	mu     sync.Mutex
+	subs   map[string]chan struct{} // subscription id -> channel which is closed to unsubscribe
+	nextID uint64
+}
+
+// serveWebSocket serves requests until connection is closed
+func (s *Server) serveWebSocket(conn *wsConn) {
+	session := &wsSession{srv: s, conn: conn, subs: make(map[string]chan struct{})}
+	session.methods = map[string]method{
+		"rpc_subscribe":   session.subscribe,
+		"rpc_unsubscribe": session.unsubscribe,
+	}
+	s.addSession(session)
+	defer s.removeSession(session)
+	defer session.close()
+
+	for {
+		data, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+		resp, _ := json.Marshal(s.handle(data, session.methods))
+		if err := conn.writeMessage(resp); err != nil {
+			return
+		}
+	}
+}
+
+// subscribe starts pushing events, and returns subscription id.
+// params: [kind, address (only for account)]
+func (ws *wsSession) subscribe(params []json.RawMessage) (interface{}, error) {
+	var kind string
+	if len(params) == 0 || json.Unmarshal(params[0], &kind) != nil {
+		return nil, ErrInvalidParams
+	}
+	var address common.Address
+	if kind == SubAccount {
+		b, err := bytesParam(params, 1)
+		if err != nil || len(b) != common.AddressLength {
+			return nil, ErrInvalidParams
+		}
+		address = common.BytesToAddress(b)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.nextID++
+	id := fmt.Sprintf("0x%x", ws.nextID)
+	quit := make(chan struct{})
+
+	switch kind {
+	case SubNewHeads:
+		ch := make(chan core.ChainHeadEvent, EventBuffer)
+		sub := ws.srv.bc.SubscribeChainHeadEvent(ch)
+		go func() {
+			defer sub.Unsubscribe()
+			for {
+				select {
+				case event := <-ch:
+					ws.notify(id, newBlock(event.Block, false))
+				case <-quit:
+					return
+				}
+			}
+		}()
+
+	case SubNewPendingTxs:
+		ch := make(chan core.NewTxsEvent, EventBuffer)
+		sub := ws.srv.pool.SubscribeNewTxsEvent(ch)
+		go func() {
+			defer sub.Unsubscribe()
+			for {
+				select {
+				case event := <-ch:
+					for _, tx := range event.Txs {
+						ws.notify(id, tx.Hash.ToHex())
+					}
+				case <-quit:
+					return
+				}
+			}
+		}()
+
+	case SubAccount:
+		// state is checked on every new head, since it can be changed by any
+		// block of new chain (e.g. in reorg)
+		ch := make(chan core.ChainHeadEvent, EventBuffer)
+		sub := ws.srv.bc.SubscribeChainHeadEvent(ch)
+		ws.srv.lock.Lock()
+		last := ws.srv.account(address)
+		ws.srv.lock.Unlock()
+		go func() {
+			defer sub.Unsubscribe()
+			for {
+				select {
+				case <-ch:
+					ws.srv.lock.Lock()
+					account := ws.srv.account(address)
+					ws.srv.lock.Unlock()
+					if account != nil && (last == nil || account.TxHash != last.TxHash) {
+						ws.notify(id, account)
+					}
+					last = account
+				case <-quit:
+					return
+				}
+			}
+		}()
+
+	default:
+		return nil, ErrInvalidParams
+	}
+	ws.subs[id] = quit
+	return id, nil
+}
+
+// unsubscribe stops pushing events of subscription. params: [subscription id]
+func (ws *wsSession) unsubscribe(params []json.RawMessage) (interface{}, error) {
+	var id string
+	if len(params) == 0 || json.Unmarshal(params[0], &id) != nil {
+		return nil, ErrInvalidParams
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	quit, ok := ws.subs[id]
+	if !ok {
+		return nil, ErrUnknownSubscription
+	}
+	close(quit)
+	delete(ws.subs, id)
+	return true, nil
+}
+
+// notify pushes result of subscription to client
+func (ws *wsSession) notify(id string, result interface{}) {
+	data, _ := json.Marshal(&notification{
+		Version: "2.0",
+		Method:  "subscription",
+		Params:  subscriptionResult{Subscription: id, Result: result},
+	})
+	ws.conn.writeMessage(data)
+}
+
+// close cancels all subscriptions, and closes connection
+func (ws *wsSession) close() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for id, quit := range ws.subs {
+		close(quit)
+		delete(ws.subs, id)
+	}
+	ws.conn.Close()
+}
+
+func (s *Server) addSession(session *wsSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session] = struct{}{}
+}
+
+func (s *Server) removeSession(session *wsSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, session)
+}
@@ -0,0 +1,207 @@
+package rpc
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocket opcodes (RFC 6455)
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// wsGUID is appended to client's key to make accept key in handshake
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	ErrNotWebSocket = errors.New("request is not websocket handshake")
+
+	ErrUnmaskedFrame = errors.New("websocket frame from client is not masked")
+
+	ErrInvalidFrame = errors.New("invalid websocket frame")
+)
+
+// isWebSocket returns whether request asks upgrading to websocket
+func isWebSocket(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[name] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn is a websocket connection (server side). messages can be written
+// concurrently, but should be read by one goroutine.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex // lock for writing a frame
+}
+
+// upgrade makes websocket handshake, and takes over connection of request
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-Websocket-Key")
+	if r.Method != http.MethodGet || !isWebSocket(r) || key == "" || r.Header.Get("Sec-Websocket-Version") != "13" {
+		return nil, ErrNotWebSocket
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, ErrNotWebSocket
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// deadlines of http server are not applied to websocket
+	conn.SetDeadline(time.Time{})
+
+	hash := sha1.Sum([]byte(key + wsGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// readMessage reads a text or binary message (fragments are joined).
+// ping is answered, and io.EOF is returned when client closes connection.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, nil)
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if started {
+				return nil, ErrInvalidFrame
+			}
+			started = true
+		case wsContinuation:
+			if !started {
+				return nil, ErrInvalidFrame
+			}
+		default:
+			return nil, ErrInvalidFrame
+		}
+
+		if len(message)+len(payload) > MaxRequestSize {
+			return nil, ErrInvalidFrame
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a frame, and unmasks its payload
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode := head[0]&0x80 != 0, head[0]&0x0f
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, ErrUnmaskedFrame
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(buf))
+	case 127:
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(buf)
+	}
+	if length > MaxRequestSize {
+		return false, 0, nil, ErrInvalidFrame
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.r, mask); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeMessage writes a text message in a frame
+func (c *wsConn) writeMessage(data []byte) error {
+	return c.writeFrame(wsText, data)
+}
+
+// writeFrame writes a frame (frames from server are not masked)
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(DefaultWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *wsConn) Close() error { return c.conn.Close() }
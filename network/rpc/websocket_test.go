@@ -0,0 +1,213 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/rlp"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+// wsClient is a minimal websocket client for tests
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, url string) *wsClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("wrong handshake: %v", resp.Status)
+	}
+	return &wsClient{t: t, conn: conn, r: r}
+}
+
+// send writes a request in a masked frame
+func (c *wsClient) send(method string, params ...interface{}) {
+	c.t.Helper()
+	payload, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	frame := []byte{0x80 | wsText}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read reads a message from server
+func (c *wsClient) read() map[string]json.RawMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		c.t.Fatal(err)
+	}
+	length := int(head[1] & 0x7f)
+	switch length {
+	case 126:
+		buf := make([]byte, 2)
+		io.ReadFull(c.r, buf)
+		length = int(binary.BigEndian.Uint16(buf))
+	case 127:
+		buf := make([]byte, 8)
+		io.ReadFull(c.r, buf)
+		length = int(binary.BigEndian.Uint64(buf))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// subscribe returns subscription id
+func (c *wsClient) subscribe(params ...interface{}) string {
+	c.t.Helper()
+	c.send("rpc_subscribe", params...)
+	var id string
+	if err := json.Unmarshal(c.read()["result"], &id); err != nil || id == "" {
+		c.t.Fatalf("failed to subscribe %v", params)
+	}
+	return id
+}
+
+// notification reads a pushed event, and decodes its result into result
+func (c *wsClient) notification(id string, result interface{}) {
+	c.t.Helper()
+	var params struct {
+		Subscription string
+		Result       json.RawMessage
+	}
+	if err := json.Unmarshal(c.read()["params"], &params); err != nil {
+		c.t.Fatal(err)
+	}
+	if params.Subscription != id {
+		c.t.Fatalf("wrong subscription %v (expected %v)", params.Subscription, id)
+	}
+	if err := json.Unmarshal(params.Result, result); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	chain := network.NewTestChain(core.NewBlockChain(memorydb.New()), 10)
+	chain.MineBlock(false)
+	bc := chain.Blockchain
+	srv := NewServer(bc, core.NewTxPool(bc), new(sync.Mutex))
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	defer srv.Stop()
+
+	client := dialWebSocket(t, ts.URL)
+	defer client.conn.Close()
+
+	// requests are served over websocket too
+	client.send("chain_head")
+	var head Block
+	if err := json.Unmarshal(client.read()["result"], &head); err != nil || head.Hash != bc.CurrentBlock().Hash().ToHex() {
+		t.Fatalf("wrong head %+v, err %v", head, err)
+	}
+
+	// new txs in txpool
+	txs := chain.AddTestTxs()
+	for len(txs) == 0 {
+		txs = chain.AddTestTxs()
+	}
+	pendingID := client.subscribe(SubNewPendingTxs)
+	raw, _ := rlp.EncodeToBytes(txs[0])
+	client.send("txpool_send", "0x"+hex.EncodeToString(raw))
+	// notification may be pushed before response
+	for i := 0; i < 2; i++ {
+		msg := client.read()
+		if _, ok := msg["id"]; ok {
+			continue
+		}
+		var params struct{ Result string }
+		json.Unmarshal(msg["params"], &params)
+		if params.Result != txs[0].Hash.ToHex() {
+			t.Fatalf("wrong pending tx %v", params.Result)
+		}
+	}
+	client.send("rpc_unsubscribe", pendingID)
+	if string(client.read()["result"]) != "true" {
+		t.Fatal("failed to unsubscribe")
+	}
+
+	// new head, and changed account
+	headsID := client.subscribe(SubNewHeads)
+	block := chain.Mine(false)
+	var pushed Block
+	client.notification(headsID, &pushed)
+	if pushed.Hash != block.Hash().ToHex() || pushed.Number != block.Number() {
+		t.Fatalf("wrong new head %+v", pushed)
+	}
+	client.send("rpc_unsubscribe", headsID)
+	client.read()
+
+	tx := chain.AddTestTxs()
+	for len(tx) == 0 {
+		tx = chain.AddTestTxs()
+	}
+	address := crypto.PubkeyToAddress(tx[0].Participants()[0]).ToHex()
+	accountID := client.subscribe(SubAccount, address)
+	chain.Mine(false)
+	var account Account
+	client.notification(accountID, &account)
+	if account.TxHash != tx[0].Hash.ToHex() {
+		t.Fatalf("wrong account %+v", account)
+	}
+
+	// errors
+	client.send("rpc_subscribe", "unknown")
+	var resp struct{ Error *Error }
+	if err := json.Unmarshal(client.read()["error"], &resp.Error); err != nil || resp.Error.Code != ErrCodeInvalidParams {
+		t.Fatal("unknown subscription is allowed")
+	}
+	client.send("rpc_unsubscribe", "0xff")
+	if _, ok := client.read()["error"]; !ok {
+		t.Fatal("unknown subscription id is allowed")
+	}
+}
@@ -0,0 +1,133 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/crypto"
+)
+
+var (
+	ErrInvalidNodeKey = errors.New("peer's node key is not ecdsa P-256 key")
+
+	ErrKeyNotPinned = errors.New("peer's node key is not pinned")
+)
+
+// LoadNodeKey loads node's private key from file, or generates and saves it
+// if file does not exist. node key identifies node in secure connections.
+func LoadNodeKey(file string) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.LoadECDSA(file)
+	if !os.IsNotExist(err) {
+		return key, err
+	}
+	if key, err = crypto.GenerateKey(); err != nil {
+		return nil, err
+	}
+	return key, crypto.SaveECDSA(file, key)
+}
+
+// TLSConfig returns config of secure connection (TLS 1.3) which is
+// authenticated by node keys. node without key (nil) can only dial, and does
+// not present its key (e.g. light node). if pinned is not empty, peer should
+// present one of pinned keys (addresses of public keys).
+func TLSConfig(key *ecdsa.PrivateKey, pinned []common.Address) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ClientAuth: tls.RequestClientCert,
+		// certificates are self-signed, so peer's key is checked below instead of CAs
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyNodeKey(rawCerts, pinned)
+		},
+	}
+	if key != nil {
+		cert, err := nodeCertificate(key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// DialSecure connects to addr with secure connection
+func DialSecure(addr string, config *tls.Config) (*Conn, error) {
+	dialer := &net.Dialer{Timeout: DefaultDialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn), nil
+}
+
+// PeerKey returns address of peer's node key in secure connection
+// (false if connection is not secure or peer has no key)
+func (c *Conn) PeerKey() (common.Address, bool) {
+	conn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return common.Address{}, false
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return common.Address{}, false
+	}
+	pub, ok := certs[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return common.Address{}, false
+	}
+	return crypto.PubkeyToAddress(pub), true
+}
+
+// nodeCertificate makes self-signed certificate of node key
+func nodeCertificate(key *ecdsa.PrivateKey) (tls.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// verifyNodeKey checks that peer's certificate has P-256 key, which is one of
+// pinned keys. (TLS handshake proves that peer has the private key)
+func verifyNodeKey(rawCerts [][]byte, pinned []common.Address) error {
+	if len(rawCerts) == 0 {
+		if len(pinned) > 0 {
+			return ErrKeyNotPinned
+		}
+		return nil
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return ErrInvalidNodeKey
+	}
+	if len(pinned) == 0 {
+		return nil
+	}
+	address := crypto.PubkeyToAddress(pub)
+	for _, pin := range pinned {
+		if address == pin {
+			return nil
+		}
+	}
+	return ErrKeyNotPinned
+}
@@ -0,0 +1,45 @@
+package network
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+func TestSecureConn(t *testing.T) {
+	bc := core.NewBlockChain(memorydb.New())
+	key, _ := crypto.GenerateKey()
+	serverConfig, err := TLSConfig(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// client which pins full node's key
+	config, _ := TLSConfig(nil, []common.Address{crypto.PubkeyToAddress(&key.PublicKey)})
+	client, server := net.Pipe()
+	go serve(NewConn(tls.Server(server, serverConfig)), bc, nil)
+	conn := NewConn(tls.Client(client, config))
+	defer conn.Close()
+	if _, err := Handshake(conn, NewStatus(bc)); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if address, ok := conn.PeerKey(); !ok || address != crypto.PubkeyToAddress(&key.PublicKey) {
+		t.Fatal("wrong peer key")
+	}
+
+	// client which pins another key
+	other, _ := crypto.GenerateKey()
+	config, _ = TLSConfig(nil, []common.Address{crypto.PubkeyToAddress(&other.PublicKey)})
+	client, server = net.Pipe()
+	go serve(NewConn(tls.Server(server, serverConfig)), bc, nil)
+	conn = NewConn(tls.Client(client, config))
+	defer conn.Close()
+	if _, err := Handshake(conn, NewStatus(bc)); err == nil {
+		t.Fatal("connected to full node whose key is not pinned")
+	}
+}
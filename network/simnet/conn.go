@@ -0,0 +1,253 @@
+package simnet
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// segment is data which arrives at receiver at a time
+type segment struct {
+	data []byte
+	at   time.Time
+}
+
+// pipe is one direction of a connection. data is sent by segments, which are
+// transmitted one by one at link's bandwidth and arrive in order after delay.
+type pipe struct {
+	link Link
+	rand *rand.Rand
+
+	mu     sync.Mutex
+	segs   []segment
+	wake   chan struct{} // closed (and replaced) when a segment is added or pipe is closed
+	sent   time.Time     // when the last segment is transmitted
+	last   time.Time     // when the last segment arrives
+	eof    bool          // sender closed
+	closed bool          // receiver closed
+}
+
+func newPipe(link Link, rnd *rand.Rand) *pipe {
+	return &pipe{link: link, rand: rnd, wake: make(chan struct{})}
+}
+
+// send queues data, and returns when it is transmitted.
+// lost segment is transmitted again after RetransmitTimeout, and segments
+// after it wait for it (in order delivery).
+func (p *pipe) send(data []byte) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return time.Time{}, io.ErrClosedPipe
+	}
+
+	if now := time.Now(); p.sent.Before(now) {
+		p.sent = now
+	}
+	p.sent = p.sent.Add(p.transmitTime(len(data)))
+	for p.link.Loss > 0 && p.rand.Float64() < p.link.Loss {
+		p.sent = p.sent.Add(RetransmitTimeout + p.transmitTime(len(data)))
+	}
+	at := p.sent.Add(p.link.Latency)
+	if p.link.Jitter > 0 {
+		at = at.Add(time.Duration(p.rand.Int63n(int64(p.link.Jitter))))
+	}
+	if at.Before(p.last) {
+		at = p.last
+	}
+	p.last = at
+
+	p.segs = append(p.segs, segment{data: append([]byte{}, data...), at: at})
+	p.signal()
+	return p.sent, nil
+}
+
+func (p *pipe) transmitTime(size int) time.Duration {
+	if p.link.Bandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(int64(size) * int64(time.Second) / int64(p.link.Bandwidth))
+}
+
+// receive copies data which has arrived into b. if nothing has arrived, it returns
+// when next segment arrives (zero time if none is sent) and a channel to wait for sending.
+func (p *pipe) receive(b []byte) (int, time.Time, <-chan struct{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.segs) == 0 {
+		if p.eof {
+			return 0, time.Time{}, nil, io.EOF
+		}
+		return 0, time.Time{}, p.wake, nil
+	}
+	seg := &p.segs[0]
+	if time.Now().Before(seg.at) {
+		return 0, seg.at, p.wake, nil
+	}
+	n := copy(b, seg.data)
+	if seg.data = seg.data[n:]; len(seg.data) == 0 {
+		p.segs = p.segs[1:]
+	}
+	return n, time.Time{}, nil, nil
+}
+
+// closeSend marks end of data (receiver reads io.EOF after remaining segments)
+func (p *pipe) closeSend() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.eof = true
+	p.signal()
+}
+
+// closeReceive drops remaining segments, and makes next sends fail
+func (p *pipe) closeReceive() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.segs = nil
+	p.signal()
+}
+
+func (p *pipe) signal() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// conn is an end of simulated connection, which implements net.Conn
+type conn struct {
+	local, remote Addr
+	r, w          *pipe
+
+	mu            sync.Mutex // lock for deadlines
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// newConnPair returns both ends of a connection over link
+func newConnPair(local, remote Addr, link Link, rnd *rand.Rand) (*conn, *conn) {
+	up := newPipe(link, newRand(rnd))
+	down := newPipe(link, newRand(rnd))
+	client := &conn{local: local, remote: remote, r: down, w: up, done: make(chan struct{})}
+	server := &conn{local: remote, remote: local, r: up, w: down, done: make(chan struct{})}
+	return client, server
+}
+
+func newRand(r *rand.Rand) *rand.Rand { return rand.New(rand.NewSource(r.Int63())) }
+
+func (c *conn) Read(b []byte) (int, error) {
+	for {
+		select {
+		case <-c.done:
+			return 0, net.ErrClosed
+		default:
+		}
+		n, until, wake, err := c.r.receive(b)
+		if n > 0 || err != nil || len(b) == 0 {
+			return n, err
+		}
+		if err := c.wait(until, c.deadline(&c.readDeadline), wake); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write blocks until data is transmitted (there is no send buffer)
+func (c *conn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		select {
+		case <-c.done:
+			return written, net.ErrClosed
+		default:
+		}
+		size := len(b)
+		if size > SegmentSize {
+			size = SegmentSize
+		}
+		sent, err := c.w.send(b[:size])
+		if err != nil {
+			return written, err
+		}
+		written += size
+		b = b[size:]
+		if time.Now().Before(sent) {
+			if err := c.wait(sent, c.deadline(&c.writeDeadline), nil); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// wait waits until the time (forever if zero) or wake is closed.
+// deadline which is set while waiting is applied from next read or write.
+func (c *conn) wait(until, deadline time.Time, wake <-chan struct{}) error {
+	var timeout, expired <-chan time.Time
+	if !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	if !deadline.IsZero() {
+		if !time.Now().Before(deadline) {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-timeout:
+	case <-wake:
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	case <-c.done:
+		return net.ErrClosed
+	}
+	return nil
+}
+
+func (c *conn) deadline(t *time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *t
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.w.closeSend()
+		c.r.closeReceive()
+	})
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline, c.writeDeadline = t, t
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,149 @@
+// Package simnet simulates network links between nodes in a process.
+// connections are shaped by bandwidth, latency, jitter and packet loss in user
+// space, so experiments (e.g. sync time of light nodes on IoT links) can run in
+// tests without traffic control of the system (network/traffic-control.sh).
+package simnet
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// SegmentSize is the maximum size of data which is sent at once (as a TCP segment)
+	SegmentSize = 1460
+
+	// RetransmitTimeout is how long sender waits before sending lost segment again
+	RetransmitTimeout = 200 * time.Millisecond
+)
+
+var (
+	ErrAddrInUse = errors.New("address already in use")
+
+	ErrConnRefused = errors.New("connection refused")
+
+	ErrInvalidLink = errors.New("invalid link condition")
+)
+
+// Link is a condition of link between two nodes (same for both directions)
+type Link struct {
+	Bandwidth int           // bytes per second (0: unlimited)
+	Latency   time.Duration // one way delay
+	Jitter    time.Duration // additional delay, random in [0, Jitter)
+	Loss      float64       // probability that a segment is lost (0 <= Loss < 1)
+}
+
+// Network is a simulated network which nodes listen and dial on.
+// randomness of links (jitter and loss) is reproducible with the same seed
+// if connections are dialed in the same order.
+type Network struct {
+	mu        sync.Mutex
+	rand      *rand.Rand
+	listeners map[string]*Listener
+	nextPort  int
+}
+
+// New returns an empty network with seed of randomness
+func New(seed int64) *Network {
+	return &Network{
+		rand:      rand.New(rand.NewSource(seed)),
+		listeners: make(map[string]*Listener),
+		nextPort:  30000,
+	}
+}
+
+// Addr is an address in simulated network ("host:port")
+type Addr string
+
+func (a Addr) Network() string { return "simnet" }
+func (a Addr) String() string  { return string(a) }
+
+// Listen listens on addr ("host:port"). port is assigned if it is 0 or empty.
+func (n *Network) Listen(addr string) (*Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if port == "" || port == "0" {
+		n.nextPort++
+		port = strconv.Itoa(n.nextPort)
+	}
+	addr = net.JoinHostPort(host, port)
+	if _, ok := n.listeners[addr]; ok {
+		return nil, ErrAddrInUse
+	}
+	l := &Listener{
+		network: n,
+		addr:    Addr(addr),
+		accepts: make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[addr] = l
+	return l, nil
+}
+
+// Dial connects to addr over link. it takes a round trip of link as TCP handshake.
+func (n *Network) Dial(addr string, link Link) (net.Conn, error) {
+	if link.Bandwidth < 0 || link.Latency < 0 || link.Jitter < 0 || link.Loss < 0 || link.Loss >= 1 {
+		return nil, ErrInvalidLink
+	}
+
+	n.mu.Lock()
+	l, ok := n.listeners[addr]
+	seed := n.rand.Int63()
+	n.nextPort++
+	local := Addr(net.JoinHostPort("dialer", strconv.Itoa(n.nextPort)))
+	n.mu.Unlock()
+	if !ok {
+		return nil, ErrConnRefused
+	}
+
+	time.Sleep(2 * link.Latency)
+	client, server := newConnPair(local, l.addr, link, rand.New(rand.NewSource(seed)))
+	select {
+	case l.accepts <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, ErrConnRefused
+	}
+}
+
+// Listener accepts connections in simulated network
+type Listener struct {
+	network *Network
+	addr    Addr
+	accepts chan net.Conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Accept waits for next connection
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accepts:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops listening (connections which are accepted are not closed)
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		l.network.mu.Lock()
+		delete(l.network.listeners, string(l.addr))
+		l.network.mu.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr { return l.addr }
@@ -0,0 +1,219 @@
+package simnet
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/nipopow"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/network"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+func TestConn(t *testing.T) {
+	sim := New(1)
+	l, err := sim.Listen("full:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	data := make([]byte, 32*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write(data)
+		conn.Close()
+	}()
+
+	// 32KB at 64KB/s takes 0.5s, and arrives after latency
+	link := Link{Bandwidth: 64 * 1024, Latency: 50 * time.Millisecond}
+	conn, err := sim.Dial(l.Addr().String(), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	received, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatal("received data mismatch")
+	}
+	if elapsed := time.Since(start); elapsed < 550*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("unexpected transfer time %v", elapsed)
+	}
+
+	if _, err := sim.Dial("full:1", link); err != ErrConnRefused {
+		t.Fatalf("dial to unknown address, err %v", err)
+	}
+	if _, err := sim.Dial(l.Addr().String(), Link{Loss: 1}); err != ErrInvalidLink {
+		t.Fatalf("dial with invalid link, err %v", err)
+	}
+}
+
+func TestConnDeadline(t *testing.T) {
+	client, server := newConnPair("a:1", "b:1", Link{Latency: 100 * time.Millisecond}, New(1).rand)
+	defer client.Close()
+	defer server.Close()
+
+	// data does not arrive before latency
+	server.Write([]byte{1})
+	client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := client.Read(make([]byte, 1)); err == nil || !err.(interface{ Timeout() bool }).Timeout() {
+		t.Fatalf("read before latency, err %v", err)
+	}
+	client.SetReadDeadline(time.Time{})
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// remaining data is read before EOF
+	server.Write([]byte{2})
+	server.Close()
+	b := make([]byte, 1)
+	if n, err := client.Read(b); n != 1 || b[0] != 2 {
+		t.Fatalf("read after close, n %d, err %v", n, err)
+	}
+	if _, err := client.Read(b); err != io.EOF {
+		t.Fatalf("read after remaining data, err %v", err)
+	}
+	if _, err := client.Write(b); err == nil {
+		t.Fatal("write to closed connection")
+	}
+}
+
+// serve runs full node's side of the protocol for every connection
+func serve(l *Listener, bc *core.BlockChain) {
+	var mu sync.Mutex // lock for blockchain
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn *network.Conn) {
+			defer conn.Close()
+			mu.Lock()
+			status := network.NewStatus(bc)
+			mu.Unlock()
+			if _, err := network.Handshake(conn, status); err != nil {
+				return
+			}
+			for {
+				msg, err := conn.ReadMsg()
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				err = network.HandleMsg(conn, bc, msg)
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}(network.NewConn(c))
+	}
+}
+
+// syncLight synchronizes a new light node as iot_light does, and returns its blockchain
+func syncLight(conn *network.Conn) (*core.BlockChain, error) {
+	status := &network.StatusData{ProtocolVersion: network.ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+	if _, err := network.Handshake(conn, status); err != nil {
+		return nil, err
+	}
+	proof := new(nipopow.Proof)
+	req := &network.GetProofData{M: params.NipopowM, K: params.NipopowK}
+	if err := network.Request(conn, network.GetProofMsg, req, network.ProofMsg, proof); err != nil {
+		return nil, err
+	}
+	if err := proof.Verify(params.MainnetGenesisHash, params.NipopowK); err != nil {
+		return nil, err
+	}
+
+	db := memorydb.New()
+	if err := network.SyncState(conn, db, proof.Tip()); err != nil {
+		return nil, err
+	}
+	var blocks []*types.Block
+	if err := network.Request(conn, network.GetInterlinksMsg, &network.GetInterlinksData{HeadHash: proof.Tip().Hash()}, network.BlocksMsg, &blocks); err != nil {
+		return nil, err
+	}
+	if err := nipopow.VerifyInterlinkChain(blocks, params.MainnetGenesisHash); err != nil {
+		return nil, err
+	}
+	head := blocks[len(blocks)-1]
+	if err := network.SyncEpochHeaders(conn, db, head.GetHeader()); err != nil {
+		return nil, err
+	}
+	return core.NewIoTBlockChain(db, head), nil
+}
+
+// syncLights synchronizes light nodes concurrently over link, and returns the longest sync time
+func syncLights(t *testing.T, bc *core.BlockChain, lights int, link Link) time.Duration {
+	sim := New(1)
+	l, err := sim.Listen("full:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serve(l, bc)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		longest time.Duration
+	)
+	for i := 0; i < lights; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			c, err := sim.Dial(l.Addr().String(), link)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn := network.NewConn(c)
+			defer conn.Close()
+			light, err := syncLight(conn)
+			if err != nil {
+				t.Errorf("failed to sync: %v", err)
+				return
+			}
+			if light.StateRoot() != bc.StateRoot() {
+				t.Error("synchronized state root mismatch")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if elapsed := time.Since(start); elapsed > longest {
+				longest = elapsed
+			}
+		}()
+	}
+	wg.Wait()
+	return longest
+}
+
+func TestSyncLightNodes(t *testing.T) {
+	bc := network.MakeTestBlockChain(30, 10, 0, false, memorydb.New())
+
+	fast := syncLights(t, bc, 4, Link{Bandwidth: 1024 * 1024, Latency: 5 * time.Millisecond})
+	slow := syncLights(t, bc, 4, Link{Bandwidth: 64 * 1024, Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 0.01})
+	t.Logf("sync time of 4 light nodes: %v at 1MB/s, %v at 64KB/s", fast, slow)
+	if slow <= fast {
+		t.Fatal("sync on slow link is not slower")
+	}
+}
@@ -0,0 +1,143 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/metrics"
+)
+
+// phases of synchronization, which costs (bytes, messages and time) are counted by.
+// phases can be nested (e.g. tx validation is a part of state download).
+const (
+	PhaseHandshake    = "handshake"
+	PhaseProof        = "proof"
+	PhaseState        = "state"
+	PhaseInterlink    = "interlink"
+	PhaseHeaders      = "headers"
+	PhaseBlocks       = "blocks"
+	PhaseDelta        = "delta"
+	PhaseFollow       = "follow"
+	PhasePeers        = "peers"
+	PhaseGossip       = "gossip"
+	PhaseTxValidation = "txvalidation"
+)
+
+var phases = []string{
+	PhaseHandshake, PhaseProof, PhaseState, PhaseInterlink, PhaseHeaders, PhaseBlocks,
+	PhaseDelta, PhaseFollow, PhasePeers, PhaseGossip, PhaseTxValidation,
+}
+
+// msgPhases maps requests (and messages which are sent without request) to
+// phases. responses are counted in the phase of last request on connection.
+var msgPhases = map[uint64]string{
+	StatusMsg:         PhaseHandshake,
+	GetProofMsg:       PhaseProof,
+	GetStateMsg:       PhaseState,
+	GetAccountsMsg:    PhaseState,
+	GetInterlinksMsg:  PhaseInterlink,
+	GetHeadersMsg:     PhaseHeaders,
+	GetBlocksMsg:      PhaseBlocks,
+	GetDeltaMsg:       PhaseDelta,
+	SubscribeMsg:      PhaseFollow,
+	NewBlockMsg:       PhaseFollow,
+	GetPeersMsg:       PhasePeers,
+	NewTxHashesMsg:    PhaseGossip,
+	GetTxsMsg:         PhaseGossip,
+	TxsMsg:            PhaseGossip,
+	NewBlockHashesMsg: PhaseGossip,
+}
+
+// PhaseCost is the cost of a phase in this process (both as light node and full node)
+type PhaseCost struct {
+	InBytes  int64 // received bytes (frames)
+	InMsgs   int64
+	OutBytes int64 // sent bytes (frames)
+	OutMsgs  int64
+	Time     time.Duration // wall-clock time (nanoseconds in JSON)
+}
+
+// phaseCounters are counters of a phase, which are published through metrics
+// as "network/<phase>/..." (regardless of metrics.Enabled)
+type phaseCounters struct {
+	inBytes, inMsgs, outBytes, outMsgs, time metrics.Counter
+}
+
+var (
+	countersMu sync.Mutex
+	counters   = make(map[string]*phaseCounters)
+)
+
+func getCounters(phase string) *phaseCounters {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+	if c, ok := counters[phase]; ok {
+		return c
+	}
+	prefix := "network/" + phase
+	c := &phaseCounters{
+		inBytes:  metrics.GetOrRegisterCounterForced(prefix+"/in/bytes", nil),
+		inMsgs:   metrics.GetOrRegisterCounterForced(prefix+"/in/msgs", nil),
+		outBytes: metrics.GetOrRegisterCounterForced(prefix+"/out/bytes", nil),
+		outMsgs:  metrics.GetOrRegisterCounterForced(prefix+"/out/msgs", nil),
+		time:     metrics.GetOrRegisterCounterForced(prefix+"/time", nil),
+	}
+	counters[phase] = c
+	return c
+}
+
+// Measure starts measuring wall-clock time of phase, and returns a function which stops it
+func Measure(phase string) func() {
+	start := time.Now()
+	return func() {
+		getCounters(phase).time.Inc(int64(time.Since(start)))
+	}
+}
+
+// SyncCosts returns costs of phases which have been counted in this process
+func SyncCosts() map[string]PhaseCost {
+	costs := make(map[string]PhaseCost)
+	for _, phase := range phases {
+		c := getCounters(phase)
+		cost := PhaseCost{
+			InBytes:  c.inBytes.Count(),
+			InMsgs:   c.inMsgs.Count(),
+			OutBytes: c.outBytes.Count(),
+			OutMsgs:  c.outMsgs.Count(),
+			Time:     time.Duration(c.time.Count()),
+		}
+		if cost != (PhaseCost{}) {
+			costs[phase] = cost
+		}
+	}
+	return costs
+}
+
+// countMsg counts a message of size bytes (frame), which is sent (out) or received
+func (c *Conn) countMsg(code uint64, size int, out bool) {
+	c.pmu.Lock()
+	if phase, ok := msgPhases[code]; ok {
+		c.phase = phase
+	}
+	phase := c.phase
+	c.pmu.Unlock()
+	if phase == "" {
+		return
+	}
+
+	counters := getCounters(phase)
+	if out {
+		counters.outBytes.Inc(int64(size))
+		counters.outMsgs.Inc(1)
+	} else {
+		counters.inBytes.Inc(int64(size))
+		counters.inMsgs.Inc(1)
+	}
+}
+
+// validateTx validates tx, measuring time of tx validation phase
+func validateTx(tx *types.Transaction) error {
+	defer Measure(PhaseTxValidation)()
+	return tx.ValidateTx()
+}
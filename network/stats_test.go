@@ -0,0 +1,45 @@
+package network
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+func TestSyncCosts(t *testing.T) {
+	bc := MakeTestBlockChain(5, 10, 0, false, memorydb.New())
+	client, server := newPipe()
+	defer client.Close()
+	go serve(server, bc, nil)
+
+	status := &StatusData{ProtocolVersion: ProtocolVersion, GenesisHash: params.MainnetGenesisHash, TD: new(big.Int)}
+	if _, err := Handshake(client, status); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	before := SyncCosts()
+	if err := SyncState(client, memorydb.New(), bc.CurrentHeader()); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	// full node counts its response before serving next request
+	var headers []*types.Header
+	if err := Request(client, GetHeadersMsg, &GetHeadersData{Origin: 1, Amount: 1}, HeadersMsg, &headers); err != nil {
+		t.Fatal(err)
+	}
+	after := SyncCosts()
+
+	// both sides are counted in this process: a request and a response
+	state := after[PhaseState]
+	state.InBytes -= before[PhaseState].InBytes
+	state.InMsgs -= before[PhaseState].InMsgs
+	state.OutBytes -= before[PhaseState].OutBytes
+	state.OutMsgs -= before[PhaseState].OutMsgs
+	if state.InMsgs != 2 || state.OutMsgs != 2 || state.InBytes != state.OutBytes || state.InBytes == 0 {
+		t.Fatalf("wrong cost of state phase: %+v", state)
+	}
+	if after[PhaseState].Time <= before[PhaseState].Time || after[PhaseTxValidation].Time <= before[PhaseTxValidation].Time {
+		t.Fatal("time of state phase is not measured")
+	}
+}
@@ -0,0 +1,283 @@
+package network
+
+import (
+	"errors"
+
+	"github.com/altair-lab/xoreum/common"
+	"github.com/altair-lab/xoreum/consensus/pow"
+	"github.com/altair-lab/xoreum/core"
+	"github.com/altair-lab/xoreum/core/nipopow"
+	"github.com/altair-lab/xoreum/core/rawdb"
+	"github.com/altair-lab/xoreum/core/state"
+	"github.com/altair-lab/xoreum/core/types"
+	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/params"
+	"github.com/altair-lab/xoreum/trie"
+	"github.com/altair-lab/xoreum/xordb"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
+)
+
+var (
+	ErrStateTxMismatch = errors.New("state's tx hash does not match with tx")
+
+	ErrStateRootMismatch = errors.New("received state does not match with state root")
+
+	ErrNoDelta = errors.New("full node cannot serve delta from the head")
+
+	ErrProofMismatch = errors.New("received blocks do not match with proof")
+
+	ErrMissingAccount = errors.New("requested account is not received")
+
+	ErrInvalidTxHeader = errors.New("header of block including tx is invalid")
+)
+
+// SyncState requests all states (address - tx hash, and txs) of head's state
+// trie from full node page by page, and writes them into db. received states
+// should match with head's state root (states are not written otherwise).
+func SyncState(c *Conn, db xordb.Database, head *types.Header) error {
+	defer Measure(PhaseState)()
+	t, _ := state.NewStateTrie(common.Hash{}, trie.NewDatabase(memorydb.New()))
+	batch := db.NewBatch()
+	origin := common.Hash{}
+	for {
+		var entries []StateEntry
+		req := &GetStateData{HeadHash: head.Hash(), Origin: origin, Limit: MaxStateServe}
+		if err := Request(c, GetStateMsg, req, StateMsg, &entries); err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if entry.Tx.GetHash() != entry.TxHash {
+				return ErrStateTxMismatch
+			}
+			if err := validateTx(entry.Tx); err != nil {
+				return err
+			}
+			t.Update(entry.Address, entry.TxHash)
+			rawdb.WriteState(batch, entry.Address, entry.TxHash)
+			rawdb.WriteTransaction(db, entry.TxHash, entry.Tx)
+		}
+
+		if len(entries) < MaxStateServe {
+			break
+		}
+		// next page starts after the last hashed address
+		next, ok := incHash(crypto.Keccak256Hash(entries[len(entries)-1].Address.Bytes()))
+		if !ok {
+			break
+		}
+		origin = next
+	}
+
+	if t.Hash() != head.Root {
+		return ErrStateRootMismatch
+	}
+	return batch.Write()
+}
+
+// incHash returns h + 1 (false if h is the maximum hash)
+func incHash(h common.Hash) (common.Hash, bool) {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			return h, true
+		}
+	}
+	return h, false
+}
+
+// SyncDelta requests interlink blocks and states changed after light node's
+// head, and moves light blockchain's head (and genesis) to full node's current
+// block. ErrNoDelta is returned if full node cannot serve it (then light node
+// should synchronize with proof, see SyncProof).
+func SyncDelta(c *Conn, bc *core.BlockChain) error {
+	defer Measure(PhaseDelta)()
+	head := bc.CurrentBlock()
+	var delta DeltaData
+	req := &GetDeltaData{HeadHash: head.Hash(), HeadNumber: head.Number(), Addresses: bc.Watched()}
+	if err := Request(c, GetDeltaMsg, req, DeltaMsg, &delta); err != nil {
+		return err
+	}
+	if len(delta.Blocks) == 0 {
+		return ErrNoDelta
+	}
+	if err := nipopow.VerifyInterlinkChainFrom(delta.Blocks, head.Hash()); err != nil {
+		return err
+	}
+	current := delta.Blocks[len(delta.Blocks)-1]
+	if current.Hash() == head.Hash() {
+		return nil
+	}
+
+	// watched IoT blockchain cannot check state root, so states are proven
+	if watched := bc.Watched(); watched != nil {
+		states, err := SyncAccounts(c, bc.GetDB(), current.Header(), watched)
+		if err != nil {
+			return err
+		}
+		if err := SyncEpochHeaders(c, bc.GetDB(), current.Header()); err != nil {
+			return err
+		}
+		return bc.ApplyStateDelta(current, states)
+	}
+
+	states := make(map[common.Address]common.Hash)
+	for _, entry := range delta.States {
+		if entry.Tx.GetHash() != entry.TxHash {
+			return ErrStateTxMismatch
+		}
+		if err := validateTx(entry.Tx); err != nil {
+			return err
+		}
+		rawdb.WriteTransaction(bc.GetDB(), entry.TxHash, entry.Tx)
+		states[entry.Address] = entry.TxHash
+	}
+
+	// headers of current block's epoch are needed to follow next blocks
+	if err := SyncEpochHeaders(c, bc.GetDB(), current.Header()); err != nil {
+		return err
+	}
+	// state root is checked with current block's
+	return bc.ApplyStateDelta(current, states)
+}
+
+// SyncProof moves light blockchain's head (and genesis) to the tip of full
+// node's nipopow proof, when delta cannot be served (e.g. light node's head is
+// orphaned). all states at the tip are received again, and light node's states
+// which are not in them are deleted.
+func SyncProof(c *Conn, bc *core.BlockChain) error {
+	stop := Measure(PhaseProof)
+	proof := new(nipopow.Proof)
+	err := Request(c, GetProofMsg, &GetProofData{M: params.NipopowM, K: params.NipopowK}, ProofMsg, proof)
+	if err == nil {
+		err = proof.Verify(params.MainnetGenesisHash, params.NipopowK)
+	}
+	stop()
+	if err != nil {
+		return err
+	}
+
+	// interlink blocks are pinned to the tip
+	stop = Measure(PhaseInterlink)
+	var blocks []*types.Block
+	err = Request(c, GetInterlinksMsg, &GetInterlinksData{HeadHash: proof.Tip().Hash()}, BlocksMsg, &blocks)
+	if err == nil {
+		err = nipopow.VerifyInterlinkChain(blocks, params.MainnetGenesisHash)
+	}
+	stop()
+	if err != nil {
+		return err
+	}
+	current := blocks[len(blocks)-1]
+	if current.Hash() != proof.Tip().Hash() {
+		return ErrProofMismatch
+	}
+
+	var states map[common.Address]common.Hash
+	if watched := bc.Watched(); watched != nil {
+		if states, err = SyncAccounts(c, bc.GetDB(), current.Header(), watched); err != nil {
+			return err
+		}
+	} else {
+		// states are received into another db not to mix them with light node's
+		db := memorydb.New()
+		if err := SyncState(c, db, current.Header()); err != nil {
+			return err
+		}
+		states = make(map[common.Address]common.Hash)
+		rawdb.IterateStates(bc.GetDB(), func(address common.Address, txHash common.Hash) {
+			states[address] = common.Hash{}
+		})
+		rawdb.IterateStates(db, func(address common.Address, txHash common.Hash) {
+			tx, _, _, _ := rawdb.ReadTransaction(db, txHash)
+			rawdb.WriteTransaction(bc.GetDB(), txHash, tx)
+			states[address] = txHash
+		})
+	}
+
+	if err := SyncEpochHeaders(c, bc.GetDB(), current.Header()); err != nil {
+		return err
+	}
+	return bc.ApplyStateDelta(current, states)
+}
+
+// SyncAccounts requests states of addresses (which light node watches) with
+// proofs against head's state root, and writes their txs into db. it returns
+// the proven states (empty tx hash if the address has no state).
+func SyncAccounts(c *Conn, db xordb.Database, head *types.Header, addresses []common.Address) (map[common.Address]common.Hash, error) {
+	defer Measure(PhaseState)()
+	states := make(map[common.Address]common.Hash)
+	for start := 0; start < len(addresses); start += MaxAccountsServe {
+		end := start + MaxAccountsServe
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+
+		var data AccountsData
+		req := &GetAccountsData{HeadHash: head.Hash(), HeadNumber: head.Number, Addresses: addresses[start:end]}
+		if err := Request(c, GetAccountsMsg, req, AccountsMsg, &data); err != nil {
+			return nil, err
+		}
+
+		txs := make(map[common.Hash]*types.Transaction)
+		for _, inclusion := range data.Txs {
+			if err := verifyInclusion(head, &inclusion); err != nil {
+				return nil, err
+			}
+			txs[inclusion.Tx.GetHash()] = inclusion.Tx
+		}
+		for _, account := range data.Accounts {
+			if err := verifyAccount(head, &account); err != nil {
+				return nil, err
+			}
+			if account.TxHash != (common.Hash{}) {
+				tx := txs[account.TxHash]
+				if tx == nil {
+					return nil, ErrStateTxMismatch
+				}
+				rawdb.WriteTransaction(db, account.TxHash, tx)
+			}
+			states[account.Address] = account.TxHash
+		}
+	}
+
+	for _, address := range addresses {
+		if _, ok := states[address]; !ok {
+			return nil, ErrMissingAccount
+		}
+	}
+	return states, nil
+}
+
+// verifyAccount checks account's state against head's state root
+func verifyAccount(head *types.Header, account *AccountProof) error {
+	if account.StateProof == nil {
+		return state.ErrInvalidStateProof
+	}
+	txHash, err := account.StateProof.Verify(head.Root, account.Address)
+	if err != nil {
+		return err
+	}
+	if txHash != account.TxHash {
+		return state.ErrInvalidStateProof
+	}
+	return nil
+}
+
+// verifyInclusion checks tx against the header of block which includes it
+// (tx is tied to head by state proof, which proves its hash)
+func verifyInclusion(head *types.Header, inclusion *TxInclusion) error {
+	if err := validateTx(inclusion.Tx); err != nil {
+		return err
+	}
+	if inclusion.Header == nil {
+		return nil
+	}
+	if inclusion.Header.Number > head.Number || pow.New().VerifySeal(nil, inclusion.Header) != nil {
+		return ErrInvalidTxHeader
+	}
+	if inclusion.Proof == nil {
+		return types.ErrInvalidTxProof
+	}
+	return types.VerifyTxProof(inclusion.Header, inclusion.Tx, inclusion.Proof)
+}
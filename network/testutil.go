@@ -2,6 +2,7 @@ package network
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"fmt"
 	"math/big"
@@ -10,213 +11,315 @@ import (
 	"github.com/altair-lab/xoreum/common"
 	"github.com/altair-lab/xoreum/core"
 	"github.com/altair-lab/xoreum/core/miner"
+	"github.com/altair-lab/xoreum/core/rawdb"
 	"github.com/altair-lab/xoreum/core/state"
 	"github.com/altair-lab/xoreum/core/types"
 	"github.com/altair-lab/xoreum/crypto"
 	"github.com/altair-lab/xoreum/xordb"
 )
 
-// make blockchain for test. insert simple blocks
-func MakeTestBlockChain(chainLength int64, partNum int64, miningInterval int, printMode bool, db xordb.Database) *core.BlockChain {
-	bc := core.NewBlockChain(db)
-	userCurTx := make(map[int64]*common.Hash) // map to fill PrevTxHashes of tx
+// TestChain makes random txs between test users, and mines blocks with them
+type TestChain struct {
+	Blockchain *core.BlockChain
+	Txpool     *core.TxPool
+	Miner      miner.Miner
+
+	privkeys  []*ecdsa.PrivateKey
+	accounts  []*state.Account
+	userCurTx map[int64]*common.Hash // map to fill PrevTxHashes of tx
+}
 
-	// initialize
-	Txpool := core.NewTxPool(bc)
-	Miner := miner.Miner{common.Address{0}}
+// NewTestChain makes partNum test users on bc. users are the same in every
+// test chain, so full nodes which make test chains share initial allocation.
+// allocation txs are applied to state directly (not through txpool), and
+// users who already have states (e.g. in loaded chain) keep them.
+func NewTestChain(bc *core.BlockChain, partNum int64) *TestChain {
+	tc := &TestChain{
+		Blockchain: bc,
+		Txpool:     core.NewTxPool(bc),
+		Miner:      miner.Miner{Coinbase: common.Address{0}},
+		userCurTx:  make(map[int64]*common.Hash),
+	}
 
-	// initialize random users
-	privkeys := []*ecdsa.PrivateKey{}
-	accounts := []*state.Account{}
+	// initialize test users
 	for i := int64(0); i < partNum; i++ {
-		priv, _ := crypto.GenerateKey()
-		privkeys = append(privkeys, priv)
+		priv := testKey(i)
+		tc.privkeys = append(tc.privkeys, priv)
+		tc.accounts = append(tc.accounts, nil)
+		if tc.refresh(i) {
+			continue
+		}
+
 		acc := state.NewAccount(&priv.PublicKey, 0, 100) // everyone has 100 won initially
-		accounts = append(accounts, acc)
-		userCurTx[int64(i)] = &common.Hash{} // initialize: nil Tx
+		tc.accounts[i] = acc
+		tx := types.NewTransaction([]*ecdsa.PublicKey{&priv.PublicKey}, []*state.Account{acc}, []*common.Hash{&common.Hash{}})
+		tx.Sign(priv)
+		bc.ApplyTransaction(tx)
+		h := tx.GetHash()
+		tc.userCurTx[int64(i)] = &h
+	}
+	return tc
+}
+
+// testKey returns i-th test user's private key (derived from i)
+func testKey(i int64) *ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	seed := crypto.Keccak256([]byte(fmt.Sprintf("xoreum test user %d", i)))
+	d := new(big.Int).SetBytes(seed)
+	d.Mod(d, new(big.Int).Sub(curve.Params().N, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+
+	priv, _ := crypto.ToECDSA(d.Bytes())
+	return priv
+}
+
+// refresh loads i-th user's current state from blockchain (it can be changed
+// by blocks of other miners). user's last tx is kept while it is in txpool,
+// so that user's next tx is chained to it. it returns false if the user has
+// no state.
+func (tc *TestChain) refresh(i int64) bool {
+	if h := tc.userCurTx[i]; h != nil && tc.Txpool.Get(*h) != nil {
+		return true
+	}
+	db := tc.Blockchain.GetDB()
+	key := &tc.privkeys[i].PublicKey
+	h := rawdb.ReadState(db, key)
+	if h == (common.Hash{}) {
+		return false
 	}
+	tx, _, _, _ := rawdb.ReadTransaction(db, h)
+	if tx == nil || tx.GetPostState(key) == nil {
+		return false
+	}
+	// account keeps user's key (tx is signed by participant of the same key)
+	acc := tx.GetPostState(key)
+	tc.accounts[i] = state.NewAccount(key, acc.Nonce, acc.Balance)
+	tc.userCurTx[i] = &h
+	return true
+}
+
+// make blockchain for test. insert simple blocks
+func MakeTestBlockChain(chainLength int64, partNum int64, miningInterval int, printMode bool, db xordb.Database) *core.BlockChain {
+	tc := NewTestChain(core.NewBlockChain(db), partNum)
 
 	// make and insert blocks into blockchain
 	for i := int64(1); i <= chainLength; i++ {
+		time.Sleep(time.Duration(miningInterval) * time.Second)
+		tc.MineBlock(printMode)
+	}
+
+	return tc.Blockchain
+}
+
+// MineBlock adds random txs into txpool, and mines and inserts a block with them
+func (tc *TestChain) MineBlock(printMode bool) *types.Block {
+	tc.AddTestTxs()
+	return tc.Mine(printMode)
+}
+
+// AddTestTxs adds random txs between test users into txpool, and returns them.
+// a user takes part in at most one tx per call, and user's tx is chained to
+// its last tx in txpool (if any).
+func (tc *TestChain) AddTestTxs() types.Transactions {
+	partNum := int64(len(tc.privkeys))
+	txs := types.Transactions{}
+	used := make(map[int64]bool)
+
+	// make random transactions
+
+	// make and insert random tx into txs
+	txnum := 2 // max tx num per block
+	if partNum < 3 {
+		// not enough users to make random txs
+		txnum = 0
+	}
+	for i := 0; i < txnum; i++ {
+		randNumber, _ := rand.Int(rand.Reader, big.NewInt(3)) // 0 ~ 2
+		randNum := randNumber.Int64()                         // convert big.int to int
+		if randNum == 0 {
+			// do not insert tx
+			continue
+		}
+
+		// fields for random tx
+		parPublicKeys := []*ecdsa.PublicKey{}
+		parStates := []*state.Account{}
+		prevTxHashes := []*common.Hash{}
+
+		// make random tx and add it into txs
+		if randNum == 1 {
+			// tx's participants number: 2
 
-		// make random transactions
+			// pick 2 random numbers
+			R1, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/2)))
+			R2, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/2)))
+			r1 := R1.Int64()
+			r2 := R2.Int64() + int64(partNum/2)
+			if time.Now().UnixNano()%2 == 0 {
+				// shuffle randomly
+				temp := r1
+				r1 = r2
+				r2 = temp
+			}
+			if used[r1] || used[r2] || !tc.refresh(r1) || !tc.refresh(r2) {
+				continue
+			}
 
-		// make and insert random tx into txs
-		txnum := 2 // max tx num per block
-		for i := 0; i < txnum; i++ {
-			randNumber, _ := rand.Int(rand.Reader, big.NewInt(3)) // 0 ~ 2
-			randNum := randNumber.Int64()                         // convert big.int to int
-			if randNum == 0 {
-				// do not insert tx
+			// make post state
+			// 1. copy current state
+			ps1 := state.NewAccount(tc.accounts[r1].PublicKey, tc.accounts[r1].Nonce, tc.accounts[r1].Balance)
+			ps2 := state.NewAccount(tc.accounts[r2].PublicKey, tc.accounts[r2].Nonce, tc.accounts[r2].Balance)
+			// 2. increase nonce
+			ps1.Nonce++
+			ps2.Nonce++
+			// 3. move random amount of balanace
+			if int64(ps2.Balance/2) == 0 {
+				// no money to give... skip this tx
 				continue
 			}
+			Amount, _ := rand.Int(rand.Reader, big.NewInt(int64(ps2.Balance/2)))
+			amount := Amount.Uint64()
+			ps1.Balance += amount
+			ps2.Balance -= amount
+
+			// fill fields for tx
+			parPublicKeys = append(parPublicKeys, ps1.PublicKey)
+			parPublicKeys = append(parPublicKeys, ps2.PublicKey)
+			parStates = append(parStates, ps1)
+			parStates = append(parStates, ps2)
+			prevTxHashes = append(prevTxHashes, tc.userCurTx[r1])
+			prevTxHashes = append(prevTxHashes, tc.userCurTx[r2])
 
-			// fields for random tx
-			parPublicKeys := []*ecdsa.PublicKey{}
-			parStates := []*state.Account{}
-			prevTxHashes := []*common.Hash{}
-
-			// make random tx and add it into txs
-			if randNum == 1 {
-				// tx's participants number: 2
-
-				// pick 2 random numbers
-				R1, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/2)))
-				R2, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/2)))
-				r1 := R1.Int64()
-				r2 := R2.Int64() + int64(partNum/2)
-				if time.Now().UnixNano()%2 == 0 {
-					// shuffle randomly
-					temp := r1
-					r1 = r2
-					r2 = temp
-				}
-
-				// make post state
-				// 1. copy current state
-				ps1 := state.NewAccount(accounts[r1].PublicKey, accounts[r1].Nonce, accounts[r1].Balance)
-				ps2 := state.NewAccount(accounts[r2].PublicKey, accounts[r2].Nonce, accounts[r2].Balance)
-				// 2. increase nonce
-				ps1.Nonce++
-				ps2.Nonce++
-				// 3. move random amount of balanace
-				if int64(ps2.Balance/2) == 0 {
-					// no money to give... skip this tx
-					continue
-				}
-				Amount, _ := rand.Int(rand.Reader, big.NewInt(int64(ps2.Balance/2)))
-				amount := Amount.Uint64()
-				ps1.Balance += amount
-				ps2.Balance -= amount
-				// 4. update current account state
-				accounts[r1] = ps1
-				accounts[r2] = ps2
-
-				// fill fields for tx
-				parPublicKeys = append(parPublicKeys, accounts[r1].PublicKey)
-				parPublicKeys = append(parPublicKeys, accounts[r2].PublicKey)
-				parStates = append(parStates, accounts[r1])
-				parStates = append(parStates, accounts[r2])
-				prevTxHashes = append(prevTxHashes, userCurTx[r1])
-				prevTxHashes = append(prevTxHashes, userCurTx[r2])
-
-				// make tx
-				tx := types.NewTransaction(parPublicKeys, parStates, prevTxHashes)
-
-				// sign tx to make valid tx
-				tx.Sign(privkeys[r1])
-				tx.Sign(privkeys[r2])
-
-				// update userCurTx
-				h := tx.GetHash()
-				userCurTx[r1] = &h
-				userCurTx[r2] = &h
-
-				// Add to txpool
-				success, err := Txpool.Add(tx)
-				if !success {
-					fmt.Println(err)
-				}
-
-			} else {
-				// tx's participants number: 3
-
-				// pick 3 random numbers
-				R1, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/3)))
-				R2, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/3)))
-				R3, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/3)))
-				r1 := R1.Int64()
-				r2 := R2.Int64() + int64(partNum/3)
-				r3 := R3.Int64() + int64(partNum/3) + int64(partNum/3)
-				if time.Now().UnixNano()%2 == 0 {
-					// shuffle randomly
-					temp := r1
-					r1 = r3
-					r3 = temp
-				}
-
-				// make post state
-				// 1. copy current state
-				ps1 := state.NewAccount(accounts[r1].PublicKey, accounts[r1].Nonce, accounts[r1].Balance)
-				ps2 := state.NewAccount(accounts[r2].PublicKey, accounts[r2].Nonce, accounts[r2].Balance)
-				ps3 := state.NewAccount(accounts[r3].PublicKey, accounts[r3].Nonce, accounts[r3].Balance)
-				// 2. increase nonce
-				ps1.Nonce++
-				ps2.Nonce++
-				ps3.Nonce++
-				// 3. move random amount of balanace
-				if int64(ps1.Balance/4) == 0 {
-					// no money to give... skip this tx
-					continue
-				}
-				Amount1, _ := rand.Int(rand.Reader, big.NewInt(int64(ps1.Balance/4)))
-				amount1 := Amount1.Uint64()
-				if int64(ps2.Balance/4) == 0 {
-					// no money to give... skip this tx
-					continue
-				}
-				Amount2, _ := rand.Int(rand.Reader, big.NewInt(int64(ps2.Balance/4)))
-				amount2 := Amount2.Uint64()
-				ps1.Balance -= amount1
-				ps2.Balance -= amount2
-				ps3.Balance += (amount1 + amount2)
-				// 4. update current account state
-				accounts[r1] = ps1
-				accounts[r2] = ps2
-				accounts[r3] = ps3
-
-				// fill fields for tx
-				parPublicKeys = append(parPublicKeys, accounts[r1].PublicKey)
-				parPublicKeys = append(parPublicKeys, accounts[r2].PublicKey)
-				parPublicKeys = append(parPublicKeys, accounts[r3].PublicKey)
-				parStates = append(parStates, accounts[r1])
-				parStates = append(parStates, accounts[r2])
-				parStates = append(parStates, accounts[r3])
-				prevTxHashes = append(prevTxHashes, userCurTx[r1])
-				prevTxHashes = append(prevTxHashes, userCurTx[r2])
-				prevTxHashes = append(prevTxHashes, userCurTx[r3])
-
-				// make tx
-				tx := types.NewTransaction(parPublicKeys, parStates, prevTxHashes)
-
-				// sign tx to make valid tx
-				tx.Sign(privkeys[r1])
-				tx.Sign(privkeys[r2])
-				tx.Sign(privkeys[r3])
-
-				// update userCurTx
-				h := tx.GetHash()
-				userCurTx[r1] = &h
-				userCurTx[r2] = &h
-				userCurTx[r3] = &h
-
-				// Add to txpool
-				success, err := Txpool.Add(tx)
-				if !success {
-					fmt.Println(err)
-				}
+			// make tx
+			tx := types.NewTransaction(parPublicKeys, parStates, prevTxHashes)
 
+			// sign tx to make valid tx
+			tx.Sign(tc.privkeys[r1])
+			tx.Sign(tc.privkeys[r2])
+
+			// Add to txpool
+			success, err := tc.Txpool.Add(tx)
+			if !success {
+				fmt.Println(err)
+				continue
 			}
 
-		}
+			// 4. update current account state and userCurTx
+			h := tx.GetHash()
+			tc.accounts[r1] = ps1
+			tc.accounts[r2] = ps2
+			tc.userCurTx[r1] = &h
+			tc.userCurTx[r2] = &h
+			used[r1], used[r2] = true, true
+			txs = append(txs, tx)
 
-		// mining block
-		time.Sleep(time.Duration(miningInterval) * time.Second)
-		b := Miner.Mine(Txpool, uint64(0))
-		if b == nil {
-			fmt.Println("Mining Fail")
-		}
+		} else {
+			// tx's participants number: 3
 
-		if (printMode) {
-			b.PrintBlock()
-		}
+			// pick 3 random numbers
+			R1, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/3)))
+			R2, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/3)))
+			R3, _ := rand.Int(rand.Reader, big.NewInt(int64(partNum/3)))
+			r1 := R1.Int64()
+			r2 := R2.Int64() + int64(partNum/3)
+			r3 := R3.Int64() + int64(partNum/3) + int64(partNum/3)
+			if time.Now().UnixNano()%2 == 0 {
+				// shuffle randomly
+				temp := r1
+				r1 = r3
+				r3 = temp
+			}
+			if used[r1] || used[r2] || used[r3] || !tc.refresh(r1) || !tc.refresh(r2) || !tc.refresh(r3) {
+				continue
+			}
+
+			// make post state
+			// 1. copy current state
+			ps1 := state.NewAccount(tc.accounts[r1].PublicKey, tc.accounts[r1].Nonce, tc.accounts[r1].Balance)
+			ps2 := state.NewAccount(tc.accounts[r2].PublicKey, tc.accounts[r2].Nonce, tc.accounts[r2].Balance)
+			ps3 := state.NewAccount(tc.accounts[r3].PublicKey, tc.accounts[r3].Nonce, tc.accounts[r3].Balance)
+			// 2. increase nonce
+			ps1.Nonce++
+			ps2.Nonce++
+			ps3.Nonce++
+			// 3. move random amount of balanace
+			if int64(ps1.Balance/4) == 0 {
+				// no money to give... skip this tx
+				continue
+			}
+			Amount1, _ := rand.Int(rand.Reader, big.NewInt(int64(ps1.Balance/4)))
+			amount1 := Amount1.Uint64()
+			if int64(ps2.Balance/4) == 0 {
+				// no money to give... skip this tx
+				continue
+			}
+			Amount2, _ := rand.Int(rand.Reader, big.NewInt(int64(ps2.Balance/4)))
+			amount2 := Amount2.Uint64()
+			ps1.Balance -= amount1
+			ps2.Balance -= amount2
+			ps3.Balance += (amount1 + amount2)
+
+			// fill fields for tx
+			parPublicKeys = append(parPublicKeys, ps1.PublicKey)
+			parPublicKeys = append(parPublicKeys, ps2.PublicKey)
+			parPublicKeys = append(parPublicKeys, ps3.PublicKey)
+			parStates = append(parStates, ps1)
+			parStates = append(parStates, ps2)
+			parStates = append(parStates, ps3)
+			prevTxHashes = append(prevTxHashes, tc.userCurTx[r1])
+			prevTxHashes = append(prevTxHashes, tc.userCurTx[r2])
+			prevTxHashes = append(prevTxHashes, tc.userCurTx[r3])
+
+			// make tx
+			tx := types.NewTransaction(parPublicKeys, parStates, prevTxHashes)
+
+			// sign tx to make valid tx
+			tx.Sign(tc.privkeys[r1])
+			tx.Sign(tc.privkeys[r2])
+			tx.Sign(tc.privkeys[r3])
+
+			// Add to txpool
+			success, err := tc.Txpool.Add(tx)
+			if !success {
+				fmt.Println(err)
+				continue
+			}
+
+			// 4. update current account state and userCurTx
+			h := tx.GetHash()
+			tc.accounts[r1] = ps1
+			tc.accounts[r2] = ps2
+			tc.accounts[r3] = ps3
+			tc.userCurTx[r1] = &h
+			tc.userCurTx[r2] = &h
+			tc.userCurTx[r3] = &h
+			used[r1], used[r2], used[r3] = true, true, true
+			txs = append(txs, tx)
 
-		// Insert block to chain
-		err := bc.Insert(b)
-		if err != nil {
-			fmt.Println(err)
 		}
+
+	}
+	return txs
+}
+
+// Mine mines a block with txs in txpool, and inserts it
+func (tc *TestChain) Mine(printMode bool) *types.Block {
+	// mining block
+	b := tc.Miner.Mine(tc.Txpool)
+	if b == nil {
+		fmt.Println("Mining Fail")
+		return nil
+	}
+
+	if printMode {
+		b.PrintBlock()
 	}
 
-	return bc
+	// Insert block to chain
+	err := tc.Blockchain.Insert(b)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return b
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/altair-lab/xoreum/core/state"
 	"github.com/altair-lab/xoreum/core/types"
 	"github.com/altair-lab/xoreum/crypto"
+	"github.com/altair-lab/xoreum/trie"
+	"github.com/altair-lab/xoreum/xordb/memorydb"
 )
 
 var (
@@ -16,11 +18,12 @@ var (
 
 func GetGenesisBlock() (b *types.Block) {
 	genesis_header := types.Header{
+		Version:    types.HeaderVersion,
 		ParentHash: crypto.Keccak256Hash(common.ToBytes("AAAAA")),
 		Coinbase:   common.Address{},
-		Root:       crypto.Keccak256Hash(common.ToBytes("AAAAA")),
-		TxHash:     crypto.Keccak256Hash(common.ToBytes("AAAAA")),
-		Difficulty: 100,
+		Root:       types.EmptyRootHash, // no state
+		TxHash:     types.EmptyRootHash, // no txs
+		Difficulty: GenesisDifficulty,
 		Time:       0,
 		Nonce:      0,
 	}
@@ -30,11 +33,12 @@ func GetGenesisBlock() (b *types.Block) {
 
 func GetGenesisBlockForBitcoin() (*types.Block, *ecdsa.PrivateKey) {
 	genesis_header := types.Header{
+		Version:    types.HeaderVersion,
 		ParentHash: crypto.Keccak256Hash(common.ToBytes("AAAAA")),
 		Coinbase:   common.Address{},
 		Root:       crypto.Keccak256Hash(common.ToBytes("AAAAA")),
 		TxHash:     crypto.Keccak256Hash(common.ToBytes("AAAAA")),
-		Difficulty: 100,
+		Difficulty: GenesisDifficulty,
 		Time:       0,
 		Nonce:      0,
 	}
@@ -71,10 +75,17 @@ func GetGenesisBlockForBitcoin() (*types.Block, *ecdsa.PrivateKey) {
 	txs := make(types.Transactions, 0)
 	txs.Insert(tx)
 
+	// state root after applying genesis tx
+	stateTrie, _ := state.NewStateTrie(common.Hash{}, trie.NewDatabase(memorydb.New()))
+	stateTrie.Update(crypto.PubkeyToAddress(&genesisPrivateKey.PublicKey), tx.Hash)
+	stateTrie.Update(crypto.PubkeyToAddress(&receiverPrivateKey.PublicKey), tx.Hash)
+	genesis_header.Root = stateTrie.Hash()
+	genesis_header.TxHash = txs.Hash()
+
 	// make valid block
 	b := types.NewBlock(&genesis_header, txs)
 	for {
-		if b.GetHeader().Hash().ToBigInt().Cmp(common.Difficulty) != -1 {
+		if b.GetHeader().Hash().ToBigInt().Cmp(b.GetHeader().Target()) != -1 {
 			b.GetHeader().Nonce++
 		} else {
 			return b, genesisPrivateKey
@@ -0,0 +1,13 @@
+package params
+
+const (
+	RetargetInterval  uint64 = 10  // difficulty is retargeted every RetargetInterval blocks
+	TargetBlockTime   uint64 = 1   // expected time (sec) to mine a block
+	MaxRetargetFactor uint64 = 4   // difficulty can be changed at most x4 (or /4) at once
+	MinimumDifficulty uint64 = 2   // the minimum that the difficulty may ever be (target: 2^255)
+	GenesisDifficulty uint64 = 100 // difficulty of genesis block
+	MaxFutureDrift    uint64 = 15  // block's timestamp can be at most MaxFutureDrift (sec) ahead of local time
+
+	NipopowM uint64 = 3 // nipopow proof keeps at least m superblocks at each level
+	NipopowK uint64 = 6 // nipopow proof's suffix has the last k blocks (common prefix parameter)
+)